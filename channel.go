@@ -2,8 +2,17 @@ package gomavlib
 
 import (
 	"io"
+	"sync"
+	"sync/atomic"
 )
 
+// componentMessage is a message written on behalf of a component that is not
+// the main component of the node.
+type componentMessage struct {
+	componentId byte
+	message     Message
+}
+
 // Channel is a communication channel created by an endpoint. For instance, a
 // TCP client endpoint creates a single channel, while a TCP server endpoint
 // creates a channel for each incoming connection.
@@ -15,35 +24,55 @@ type Channel struct {
 	rwc        io.ReadWriteCloser
 	n          *Node
 	parser     *Parser
-	writeChan  chan interface{}
+	writeQueue *channelQueue
 	allWritten chan struct{}
+	stats      *channelStats
+
+	firewallMutex sync.Mutex
+	firewall      *Firewall
+	rateLimiter   *channelRateLimiter
+	link          *Link
+	linkIndex     int
 }
 
-func newChannel(n *Node, e Endpoint, label string, rwc io.ReadWriteCloser) (*Channel, error) {
+func newChannel(n *Node, e Endpoint, proto *channelProtocol, label string, rwc io.ReadWriteCloser) (*Channel, error) {
+	stats := newChannelStats()
+
 	parser, err := NewParser(ParserConf{
-		Reader:             rwc,
-		Writer:             rwc,
-		D:                  n.conf.D,
-		InKey:              n.conf.InKey,
+		Reader:             &channelStatsReader{rwc, stats},
+		Writer:             &channelStatsWriter{rwc, stats},
+		D:                  proto.d,
+		InVersion:          proto.inVersion,
+		InKey:              proto.inKey,
 		OutSystemId:        n.conf.OutSystemId,
-		OutVersion:         n.conf.OutVersion,
+		OutVersion:         proto.outVersion,
 		OutComponentId:     n.conf.OutComponentId,
 		OutSignatureLinkId: randomByte(),
-		OutKey:             n.conf.OutKey,
+		OutKey:             proto.outKey,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &Channel{
+	ch := &Channel{
 		Endpoint:   e,
 		label:      label,
 		rwc:        rwc,
 		n:          n,
 		parser:     parser,
-		writeChan:  make(chan interface{}),
+		writeQueue: newChannelQueue(n.conf.WriteQueueSize, n.conf.WriteQueuePolicy),
 		allWritten: make(chan struct{}),
-	}, nil
+		stats:      stats,
+		firewall:   proto.firewall,
+		link:       proto.link,
+		linkIndex:  proto.linkIndex,
+	}
+
+	if proto.rateLimit != nil {
+		ch.rateLimiter = newChannelRateLimiter(*proto.rateLimit, n.conf.WriteQueueSize)
+	}
+
+	return ch, nil
 }
 
 // String implements fmt.Stringer and returns the channel label.
@@ -51,9 +80,113 @@ func (ch *Channel) String() string {
 	return ch.label
 }
 
+// DroppedFrames returns the number of outgoing messages and frames that have
+// been discarded because the outgoing queue of the channel was full, or
+// because the byte budget of its RateLimit was over for too long.
+func (ch *Channel) DroppedFrames() uint64 {
+	return atomic.LoadUint64(&ch.writeQueue.dropped)
+}
+
+// Stats returns the statistics of the channel.
+func (ch *Channel) Stats() *ChannelStats {
+	return ch.stats.snapshot()
+}
+
+// SetFirewall sets the firewall of the channel, replacing the one of the
+// endpoint. The firewall must not be modified after it has been set.
+// A nil firewall allows all frames.
+func (ch *Channel) SetFirewall(fw *Firewall) {
+	ch.firewallMutex.Lock()
+	defer ch.firewallMutex.Unlock()
+	ch.firewall = fw
+}
+
+func (ch *Channel) getFirewall() *Firewall {
+	ch.firewallMutex.Lock()
+	defer ch.firewallMutex.Unlock()
+	return ch.firewall
+}
+
+// outPacket returns the properties of an outgoing item that are checked by
+// the firewall.
+func (ch *Channel) outPacket(what interface{}) *firewallPacket {
+	switch wh := what.(type) {
+	case Frame:
+		// signatures of routed frames are not validated by this channel
+		return newFirewallPacket(wh, false)
+
+	case *componentMessage:
+		return &firewallPacket{
+			msg:         wh.message,
+			systemId:    ch.n.conf.OutSystemId,
+			componentId: wh.componentId,
+			signed:      ch.parser.conf.OutKey != nil && ch.parser.OutVersion() == V2,
+		}
+	}
+
+	return &firewallPacket{
+		msg:         what.(Message),
+		systemId:    ch.n.conf.OutSystemId,
+		componentId: ch.n.conf.OutComponentId,
+		signed:      ch.parser.conf.OutKey != nil && ch.parser.OutVersion() == V2,
+	}
+}
+
+func (ch *Channel) write(what interface{}) {
+	// messages are converted into the dialect of the channel, that can be
+	// different from the one of the node (see EndpointOverride)
+	var err error
+	switch wh := what.(type) {
+	case Message:
+		wh, err = dialectConvertMessage(ch.parser.conf.D, wh)
+		if err == nil {
+			err = ch.parser.WriteMessage(wh)
+		}
+
+	case Frame:
+		wh, err = ch.convertFrame(wh)
+		if err == nil {
+			err = ch.parser.WriteFrame(wh)
+		}
+
+	case *componentMessage:
+		var msg Message
+		msg, err = dialectConvertMessage(ch.parser.conf.D, wh.message)
+		if err == nil {
+			err = ch.parser.writeMessageAs(wh.componentId, msg)
+		}
+	}
+	if err != nil {
+		ch.stats.onWriteError()
+		return
+	}
+	ch.stats.onFrameOut()
+}
+
+func (ch *Channel) convertFrame(f Frame) (Frame, error) {
+	msg, err := dialectConvertMessage(ch.parser.conf.D, f.GetMessage())
+	if err != nil {
+		return nil, err
+	}
+	if msg == f.GetMessage() {
+		return f, nil
+	}
+
+	// do not touch the original frame, since it can be written by other
+	// channels in parallel
+	f = f.Clone()
+	switch ff := f.(type) {
+	case *FrameV1:
+		ff.Message = msg
+	case *FrameV2:
+		ff.Message = msg
+	}
+	return f, nil
+}
+
 func (ch *Channel) close() {
 	// wait until all frame have been written
-	close(ch.writeChan)
+	ch.writeQueue.close()
 	<-ch.allWritten
 
 	// close reader/writer after ensuring all frames have been written
@@ -65,29 +198,79 @@ func (ch *Channel) run() {
 	readerDone := make(chan struct{})
 	go func() {
 		defer func() { readerDone <- struct{}{} }()
-		defer func() { ch.n.eventsOut <- &EventChannelClose{ch} }()
+		defer func() {
+			if ch.n.nodeLinks != nil {
+				ch.n.nodeLinks.onChannelClose(ch)
+			}
+		}()
+		defer func() { ch.n.emitEvent(&EventChannelClose{ch}) }()
 		defer func() { ch.n.eventsIn <- &eventInChannelClosed{ch} }()
 
-		ch.n.eventsOut <- &EventChannelOpen{ch}
+		ch.n.emitEvent(&EventChannelOpen{ch})
+
+		if ch.n.nodeLinks != nil {
+			ch.n.nodeLinks.onChannelOpen(ch)
+		}
 
 		for {
 			frame, err := ch.parser.Read()
 			if err != nil {
 				// continue in case of parse errors
 				if _, ok := err.(*ParserError); ok {
-					ch.n.eventsOut <- &EventParseError{err, ch}
+					ch.stats.onParseError()
+					ch.n.emitEvent(&EventParseError{err, ch})
 					continue
 				}
 				return
 			}
 
+			ch.stats.onFrameIn(frame)
+
+			// the parser validates signatures only when InKey is set
+			if fw := ch.getFirewall(); fw != nil &&
+				!fw.allowsIn(newFirewallPacket(frame, ch.parser.conf.InKey != nil)) {
+				ch.stats.onFrameBlockedIn()
+				continue
+			}
+
+			// link health is computed before deduplication, since it depends
+			// on the frames received by each channel
+			if ch.n.nodeLinks != nil {
+				ch.n.nodeLinks.onFrame(ch, frame)
+			}
+
 			evt := &EventFrame{frame, ch}
 
+			// routes are learned before deduplication, since a target can be
+			// reachable through multiple channels
+			ch.n.nodeRouter.onEventFrame(evt)
+
+			// frames received through links are always deduplicated
+			if ch.n.nodeDedup != nil && (ch.n.conf.DedupEnable || ch.link != nil) &&
+				ch.n.nodeDedup.isDuplicate(ch, frame) {
+				ch.stats.onDuplicateSuppressed()
+				continue
+			}
+
+			if ch.n.nodeRegistry != nil {
+				ch.n.nodeRegistry.onEventFrame(evt)
+			}
+
+			if ch.n.nodeCommand != nil {
+				ch.n.nodeCommand.onEventFrame(evt)
+			}
+
 			if ch.n.nodeStreamRequest != nil {
 				ch.n.nodeStreamRequest.onEventFrame(evt)
 			}
 
-			ch.n.eventsOut <- evt
+			if ch.n.nodeTimesync != nil {
+				ch.n.nodeTimesync.onEventFrame(evt)
+			}
+
+			ch.n.dispatchFrameListeners(evt)
+
+			ch.n.emitEvent(evt)
 		}
 	}()
 
@@ -97,14 +280,23 @@ func (ch *Channel) run() {
 		defer func() { writerDone <- struct{}{} }()
 		defer func() { ch.allWritten <- struct{}{} }()
 
-		for what := range ch.writeChan {
-			switch wh := what.(type) {
-			case Message:
-				ch.parser.WriteMessage(wh)
+		if ch.rateLimiter != nil {
+			ch.runRateLimitedWriter(ch.rateLimiter)
+			return
+		}
+
+		for {
+			what, ok := ch.writeQueue.pop()
+			if ok == false {
+				break
+			}
 
-			case Frame:
-				ch.parser.WriteFrame(wh)
+			if fw := ch.getFirewall(); fw != nil && !fw.allowsOut(ch.outPacket(what)) {
+				ch.stats.onFrameBlockedOut()
+				continue
 			}
+
+			ch.write(what)
 		}
 	}()
 
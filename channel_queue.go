@@ -0,0 +1,234 @@
+package gomavlib
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteQueuePolicy is the policy applied when the outgoing queue of a channel is full.
+type WriteQueuePolicy int
+
+const (
+	// WriteQueueDropOldest discards the oldest queued frame in order to make
+	// space for the new one. Frames with a lower priority are discarded first,
+	// while frames with a higher priority than the new one are never discarded.
+	WriteQueueDropOldest WriteQueuePolicy = iota
+	// WriteQueueDropNewest discards the new frame, unless a frame with a lower
+	// priority is queued, in which case the newest of such frames is discarded.
+	WriteQueueDropNewest
+	// WriteQueueBlock makes the routine that is writing wait until there's
+	// space in the queue. The node and the other channels are not affected.
+	WriteQueueBlock
+)
+
+// Priority is the priority class of an outgoing message or frame.
+// Each channel writes frames with a higher priority before the others.
+type Priority int
+
+const (
+	// PriorityLow is the class of frames that are written only when there
+	// are no other frames to write, or to prevent starvation.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default class.
+	PriorityNormal Priority = 0
+	// PriorityHigh is the class of frames that are written before the others.
+	PriorityHigh Priority = 1
+)
+
+const (
+	priorityCount = 3
+
+	// the number of consecutive times a priority class can be skipped in
+	// favour of higher ones, before one of its elements is written anyway.
+	queueStarvationLimit = 8
+)
+
+func (p Priority) index() int {
+	switch {
+	case p < PriorityNormal:
+		return 0
+	case p > PriorityNormal:
+		return 2
+	}
+	return 1
+}
+
+// channelQueue is a bounded queue that contains the messages and frames
+// waiting to be written to a channel. Elements are ordered by priority and
+// then by insertion. It supports multiple producers and a single consumer.
+type channelQueue struct {
+	size    int
+	policy  WriteQueuePolicy
+	mutex   sync.Mutex
+	items   [priorityCount][]interface{}
+	count   int
+	skipped [priorityCount]int
+	closed  bool
+	pushed  chan struct{}
+	popped  *sync.Cond
+	dropped uint64
+}
+
+func newChannelQueue(size int, policy WriteQueuePolicy) *channelQueue {
+	q := &channelQueue{
+		size:   size,
+		policy: policy,
+		pushed: make(chan struct{}, 1),
+	}
+	q.popped = sync.NewCond(&q.mutex)
+	return q
+}
+
+func (q *channelQueue) signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// lowest returns the lowest priority class that contains elements and that is
+// not higher than the given one.
+func (q *channelQueue) lowest(max int) (int, bool) {
+	for i := 0; i <= max; i++ {
+		if len(q.items[i]) > 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// push adds an element to the queue, applying the policy if the queue is full.
+func (q *channelQueue) push(what interface{}, priority Priority) {
+	pi := priority.index()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		if q.closed {
+			return
+		}
+
+		if q.count < q.size {
+			q.items[pi] = append(q.items[pi], what)
+			q.count++
+			q.signal(q.pushed)
+			return
+		}
+
+		switch q.policy {
+		case WriteQueueDropOldest:
+			if i, ok := q.lowest(pi); ok {
+				q.items[i][0] = nil
+				q.items[i] = q.items[i][1:]
+				q.items[pi] = append(q.items[pi], what)
+			}
+			atomic.AddUint64(&q.dropped, 1)
+			return
+
+		case WriteQueueDropNewest:
+			if i, ok := q.lowest(pi - 1); ok {
+				q.items[i][len(q.items[i])-1] = nil
+				q.items[i] = q.items[i][:len(q.items[i])-1]
+				q.items[pi] = append(q.items[pi], what)
+			}
+			atomic.AddUint64(&q.dropped, 1)
+			return
+		}
+
+		// wait until an element is popped or the queue is closed
+		q.popped.Wait()
+	}
+}
+
+// tryPush adds an element to the queue, or returns false if the queue is full.
+func (q *channelQueue) tryPush(what interface{}, priority Priority) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed || q.count >= q.size {
+		return false
+	}
+
+	pi := priority.index()
+	q.items[pi] = append(q.items[pi], what)
+	q.count++
+	q.signal(q.pushed)
+	return true
+}
+
+// next returns the priority class of the next element to pop.
+func (q *channelQueue) next() int {
+	// prevent starvation of lower classes
+	for i := 0; i < priorityCount; i++ {
+		if len(q.items[i]) > 0 && q.skipped[i] >= queueStarvationLimit {
+			return i
+		}
+	}
+
+	for i := priorityCount - 1; i >= 0; i-- {
+		if len(q.items[i]) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// pop waits for an element and removes it from the queue. It returns false
+// when the queue has been closed and all elements have been consumed.
+func (q *channelQueue) pop() (interface{}, bool) {
+	what, _, ok := q.popWait(nil)
+	return what, ok
+}
+
+// popWait is like pop, but it also returns the priority class of the element,
+// and it returns a nil element when wake is triggered before an element is
+// available.
+func (q *channelQueue) popWait(wake <-chan time.Time) (interface{}, int, bool) {
+	for {
+		q.mutex.Lock()
+
+		if q.count > 0 {
+			pi := q.next()
+
+			for i := 0; i < priorityCount; i++ {
+				if i == pi {
+					q.skipped[i] = 0
+				} else if i < pi && len(q.items[i]) > 0 {
+					q.skipped[i]++
+				}
+			}
+
+			what := q.items[pi][0]
+			q.items[pi][0] = nil
+			q.items[pi] = q.items[pi][1:]
+			q.count--
+			q.popped.Broadcast()
+			q.mutex.Unlock()
+			return what, pi, true
+		}
+
+		if q.closed {
+			q.mutex.Unlock()
+			return nil, 0, false
+		}
+
+		q.mutex.Unlock()
+
+		select {
+		case <-q.pushed:
+		case <-wake:
+			return nil, 0, true
+		}
+	}
+}
+
+func (q *channelQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.signal(q.pushed)
+	q.popped.Broadcast()
+}
@@ -0,0 +1,150 @@
+package gomavlib
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelQueuePolicies(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		policy  WriteQueuePolicy
+		content []interface{}
+	}{
+		{"drop oldest", WriteQueueDropOldest, []interface{}{3, 4, 5}},
+		{"drop newest", WriteQueueDropNewest, []interface{}{1, 2, 3}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			q := newChannelQueue(3, ca.policy)
+			for i := 1; i <= 5; i++ {
+				q.push(i, PriorityNormal)
+			}
+			require.Equal(t, false, q.tryPush(6, PriorityNormal))
+			require.Equal(t, uint64(2), q.dropped)
+
+			q.close()
+
+			var content []interface{}
+			for {
+				what, ok := q.pop()
+				if ok == false {
+					break
+				}
+				content = append(content, what)
+			}
+			require.Equal(t, ca.content, content)
+		})
+	}
+}
+
+func TestChannelQueueBlock(t *testing.T) {
+	q := newChannelQueue(1, WriteQueueBlock)
+	q.push(1, PriorityNormal)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.push(2, PriorityNormal)
+	}()
+
+	what, _ := q.pop()
+	require.Equal(t, 1, what)
+	<-done
+	what, _ = q.pop()
+	require.Equal(t, 2, what)
+	require.Equal(t, uint64(0), q.dropped)
+}
+
+func TestChannelQueueBlockClose(t *testing.T) {
+	q := newChannelQueue(1, WriteQueueBlock)
+	q.push(1, PriorityNormal)
+
+	// all blocked writers are released when the queue is closed
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.push(2, PriorityNormal)
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	q.close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("writers are still blocked")
+	}
+}
+
+func TestChannelQueuePriority(t *testing.T) {
+	q := newChannelQueue(100, WriteQueueBlock)
+	for i := 0; i < 12; i++ {
+		q.push(i, PriorityNormal)
+	}
+	q.push("low", PriorityLow)
+	for i := 0; i < 12; i++ {
+		q.push(100+i, PriorityHigh)
+	}
+
+	var content []interface{}
+	for i := 0; i < 25; i++ {
+		what, _ := q.pop()
+		content = append(content, what)
+	}
+
+	// high priority elements are popped first, normal and low priority
+	// elements are popped after being skipped queueStarvationLimit times
+	require.Equal(t, []interface{}{
+		100, 101, 102, 103, 104, 105, 106, 107, "low", 0,
+		108, 109, 110, 111, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	}, content)
+}
+
+func TestChannelQueuePriorityDrop(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		policy  WriteQueuePolicy
+		content []interface{}
+	}{
+		{"drop oldest", WriteQueueDropOldest, []interface{}{"high1", "high2", "normal2"}},
+		{"drop newest", WriteQueueDropNewest, []interface{}{"high1", "high2", "normal1"}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			q := newChannelQueue(3, ca.policy)
+			q.push("normal1", PriorityNormal)
+			q.push("normal2", PriorityNormal)
+			q.push("high1", PriorityHigh)
+
+			// lower priority elements are dropped in favour of higher ones
+			q.push("high2", PriorityHigh)
+
+			// higher priority elements are never dropped
+			q.push("low", PriorityLow)
+
+			require.Equal(t, uint64(2), q.dropped)
+			q.close()
+
+			var content []interface{}
+			for {
+				what, ok := q.pop()
+				if ok == false {
+					break
+				}
+				content = append(content, what)
+			}
+			require.Equal(t, ca.content, content)
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package gomavlib
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitStateful contains the messages of microservices (parameters,
+// missions, commands, FTP, logs, etc), that can't be coalesced since each
+// of them carries a different part of a transfer or a reply.
+var rateLimitStateful = map[uint32]struct{}{
+	4:   {}, // PING
+	20:  {}, // PARAM_REQUEST_READ
+	21:  {}, // PARAM_REQUEST_LIST
+	22:  {}, // PARAM_VALUE
+	23:  {}, // PARAM_SET
+	37:  {}, // MISSION_REQUEST_PARTIAL_LIST
+	38:  {}, // MISSION_WRITE_PARTIAL_LIST
+	39:  {}, // MISSION_ITEM
+	40:  {}, // MISSION_REQUEST
+	41:  {}, // MISSION_SET_CURRENT
+	43:  {}, // MISSION_REQUEST_LIST
+	44:  {}, // MISSION_COUNT
+	45:  {}, // MISSION_CLEAR_ALL
+	46:  {}, // MISSION_ITEM_REACHED
+	47:  {}, // MISSION_ACK
+	51:  {}, // MISSION_REQUEST_INT
+	73:  {}, // MISSION_ITEM_INT
+	75:  {}, // COMMAND_INT
+	76:  {}, // COMMAND_LONG
+	77:  {}, // COMMAND_ACK
+	110: {}, // FILE_TRANSFER_PROTOCOL
+	111: {}, // TIMESYNC
+	117: {}, // LOG_REQUEST_LIST
+	118: {}, // LOG_ENTRY
+	119: {}, // LOG_REQUEST_DATA
+	120: {}, // LOG_DATA
+	121: {}, // LOG_ERASE
+	122: {}, // LOG_REQUEST_END
+	253: {}, // STATUSTEXT
+}
+
+// RateLimit limits the frames written to the channels of an endpoint.
+// Frames that exceed the rate of their message are coalesced, such that only
+// the latest frame of each system, component and message is kept and
+// written as soon as the rate allows it.
+// When the byte budget is over, the outgoing queue is still consumed: frames
+// of rate-limited messages are coalesced, while the other ones are stored
+// up to WriteQueueSize and written by priority, discarding the oldest ones
+// with the lowest priority (see DroppedFrames()).
+type RateLimit struct {
+	// (optional) the maximum rate of each message, in Hz, indexed by message id.
+	MessageRates map[uint32]float64
+	// (optional) the maximum rate of each message that is not in MessageRates,
+	// in Hz. It does not apply to the messages of microservices (parameters,
+	// missions, commands, FTP, logs, status texts), that can't be coalesced.
+	// If not provided, these messages are limited only by ByteRate.
+	DefaultRate float64
+	// (optional) the maximum number of bytes written per second.
+	// If not provided, the number of bytes is not limited.
+	ByteRate int
+}
+
+type rateLimiterKey struct {
+	systemId    byte
+	componentId byte
+	messageId   uint32
+}
+
+type rateLimiterItem struct {
+	key  rateLimiterKey
+	what interface{}
+}
+
+// channelRateLimiter applies a RateLimit to the outgoing frames of a channel.
+// It is used by the writer routine only.
+type channelRateLimiter struct {
+	conf         RateLimit
+	last         map[rateLimiterKey]time.Time
+	pending      map[rateLimiterKey]interface{}
+	order        []rateLimiterKey
+	backlog      [priorityCount][]rateLimiterItem
+	backlogCount int
+	backlogSize  int
+	tokens       float64
+	tokensT      time.Time
+}
+
+func newChannelRateLimiter(conf RateLimit, backlogSize int) *channelRateLimiter {
+	return &channelRateLimiter{
+		conf:        conf,
+		last:        make(map[rateLimiterKey]time.Time),
+		pending:     make(map[rateLimiterKey]interface{}),
+		backlogSize: backlogSize,
+		tokens:      float64(conf.ByteRate),
+		tokensT:     time.Now(),
+	}
+}
+
+func (l *channelRateLimiter) interval(messageId uint32) time.Duration {
+	rate, ok := l.conf.MessageRates[messageId]
+	if !ok {
+		if _, ok := rateLimitStateful[messageId]; ok {
+			return 0
+		}
+		rate = l.conf.DefaultRate
+	}
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rate)
+}
+
+func (l *channelRateLimiter) nextAllowed(key rateLimiterKey) time.Time {
+	last, ok := l.last[key]
+	if !ok {
+		return time.Time{}
+	}
+	return last.Add(l.interval(key.messageId))
+}
+
+// hasBudget returns whether the byte budget allows to write a frame.
+func (l *channelRateLimiter) hasBudget(now time.Time) bool {
+	if l.conf.ByteRate <= 0 {
+		return true
+	}
+
+	l.tokens += now.Sub(l.tokensT).Seconds() * float64(l.conf.ByteRate)
+	if l.tokens > float64(l.conf.ByteRate) {
+		l.tokens = float64(l.conf.ByteRate)
+	}
+	l.tokensT = now
+
+	return l.tokens > 0
+}
+
+// push returns true if the item can be written immediately, otherwise it
+// stores the item until its rate allows it, replacing any older item with the
+// same key. The second return value is true if an item has been replaced.
+func (l *channelRateLimiter) push(key rateLimiterKey, what interface{}, now time.Time) (bool, bool) {
+	if _, ok := l.pending[key]; ok {
+		l.pending[key] = what
+		return false, true
+	}
+
+	if l.interval(key.messageId) == 0 || !now.Before(l.nextAllowed(key)) {
+		return true, false
+	}
+
+	l.pending[key] = what
+	l.order = append(l.order, key)
+	return false, false
+}
+
+// hold stores an item that can't be written since the byte budget is over.
+// Items of rate-limited messages are coalesced, the other ones are stored by
+// priority class, discarding the oldest one with the lowest priority when
+// there are too many. Items with a higher priority than the new one are never
+// discarded.
+// The return values are true if an item has been replaced or discarded.
+func (l *channelRateLimiter) hold(key rateLimiterKey, what interface{}, pi int) (bool, bool) {
+	if l.interval(key.messageId) != 0 {
+		if _, ok := l.pending[key]; ok {
+			l.pending[key] = what
+			return true, false
+		}
+		l.pending[key] = what
+		l.order = append(l.order, key)
+		return false, false
+	}
+
+	l.backlog[pi] = append(l.backlog[pi], rateLimiterItem{key, what})
+	l.backlogCount++
+
+	if l.backlogCount > l.backlogSize {
+		// the class of the new item is not empty, therefore an item is
+		// always found
+		for i := 0; i <= pi; i++ {
+			if len(l.backlog[i]) > 0 {
+				l.backlog[i][0] = rateLimiterItem{}
+				l.backlog[i] = l.backlog[i][1:]
+				l.backlogCount--
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// popReady returns the oldest stored item whose rate allows it to be written.
+// Items stored when the byte budget was over are returned first, by priority.
+func (l *channelRateLimiter) popReady(now time.Time) (rateLimiterKey, interface{}, bool) {
+	for i := priorityCount - 1; i >= 0; i-- {
+		if len(l.backlog[i]) > 0 {
+			item := l.backlog[i][0]
+			l.backlog[i][0] = rateLimiterItem{}
+			l.backlog[i] = l.backlog[i][1:]
+			l.backlogCount--
+			return item.key, item.what, true
+		}
+	}
+
+	for i, key := range l.order {
+		if !now.Before(l.nextAllowed(key)) {
+			what := l.pending[key]
+			delete(l.pending, key)
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			return key, what, true
+		}
+	}
+	return rateLimiterKey{}, nil, false
+}
+
+// popAll returns all the stored items.
+func (l *channelRateLimiter) popAll() []interface{} {
+	ret := make([]interface{}, 0, l.backlogCount+len(l.order))
+	for i := priorityCount - 1; i >= 0; i-- {
+		for _, item := range l.backlog[i] {
+			ret = append(ret, item.what)
+		}
+		l.backlog[i] = nil
+	}
+	l.backlogCount = 0
+	for _, key := range l.order {
+		ret = append(ret, l.pending[key])
+		delete(l.pending, key)
+	}
+	l.order = nil
+	return ret
+}
+
+func (l *channelRateLimiter) onWritten(key rateLimiterKey, now time.Time, bytes uint64) {
+	if l.interval(key.messageId) != 0 {
+		l.last[key] = now
+	}
+	l.tokens -= float64(bytes)
+}
+
+// nextWake returns the time at which the limiter must be checked again.
+func (l *channelRateLimiter) nextWake(now time.Time) (time.Time, bool) {
+	// wait until the byte budget is positive again
+	if l.conf.ByteRate > 0 && l.tokens <= 0 {
+		return now.Add(time.Duration((-l.tokens + 1) * float64(time.Second) /
+			float64(l.conf.ByteRate))), true
+	}
+
+	if l.backlogCount > 0 {
+		return now, true
+	}
+
+	var ret time.Time
+	found := false
+	for _, key := range l.order {
+		t := l.nextAllowed(key)
+		if !found || t.Before(ret) {
+			ret = t
+			found = true
+		}
+	}
+	return ret, found
+}
+
+// runRateLimitedWriter is the writer routine of channels with a RateLimit.
+func (ch *Channel) runRateLimitedWriter(l *channelRateLimiter) {
+	write := func(key rateLimiterKey, what interface{}, now time.Time) {
+		before := ch.stats.getBytesOut()
+		ch.write(what)
+		l.onWritten(key, now, ch.stats.getBytesOut()-before)
+	}
+
+	for {
+		now := time.Now()
+
+		// write stored items whose rate allows it
+		for l.hasBudget(now) {
+			key, what, ok := l.popReady(now)
+			if !ok {
+				break
+			}
+			write(key, what, now)
+			now = time.Now()
+		}
+
+		var timer *time.Timer
+		var wake <-chan time.Time
+		if t, ok := l.nextWake(now); ok {
+			timer = time.NewTimer(t.Sub(now))
+			wake = timer.C
+		}
+
+		what, pi, ok := ch.writeQueue.popWait(wake)
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if !ok {
+			// the channel is being closed, write stored items
+			for _, what := range l.popAll() {
+				ch.write(what)
+			}
+			return
+		}
+
+		if what == nil {
+			continue
+		}
+
+		p := ch.outPacket(what)
+
+		if fw := ch.getFirewall(); fw != nil && !fw.allowsOut(p) {
+			ch.stats.onFrameBlockedOut()
+			continue
+		}
+
+		key := rateLimiterKey{p.systemId, p.componentId, p.msg.GetId()}
+		now = time.Now()
+
+		// the byte budget is over, store the item instead of blocking the queue
+		if !l.hasBudget(now) {
+			replaced, dropped := l.hold(key, what, pi)
+			if replaced {
+				ch.stats.onFrameCoalesced()
+			}
+			if dropped {
+				atomic.AddUint64(&ch.writeQueue.dropped, 1)
+			}
+			continue
+		}
+
+		writeNow, replaced := l.push(key, what, now)
+		if replaced {
+			ch.stats.onFrameCoalesced()
+		}
+		if writeNow {
+			write(key, what, now)
+		}
+	}
+}
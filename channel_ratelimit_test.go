@@ -0,0 +1,223 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelRateLimiter(t *testing.T) {
+	l := newChannelRateLimiter(RateLimit{
+		MessageRates: map[uint32]float64{30: 5},
+		DefaultRate:  2,
+	}, 10)
+	now := time.Now()
+	att := rateLimiterKey{1, 1, 30}
+	hb := rateLimiterKey{1, 1, 0}
+
+	// first frames are written immediately
+	writeNow, _ := l.push(att, 1, now)
+	require.Equal(t, true, writeNow)
+	l.onWritten(att, now, 10)
+	writeNow, _ = l.push(hb, 2, now)
+	require.Equal(t, true, writeNow)
+	l.onWritten(hb, now, 10)
+
+	// excess frames are coalesced
+	writeNow, replaced := l.push(att, 3, now.Add(10*time.Millisecond))
+	require.Equal(t, false, writeNow)
+	require.Equal(t, false, replaced)
+	writeNow, replaced = l.push(att, 4, now.Add(20*time.Millisecond))
+	require.Equal(t, false, writeNow)
+	require.Equal(t, true, replaced)
+	writeNow, _ = l.push(hb, 5, now.Add(30*time.Millisecond))
+	require.Equal(t, false, writeNow)
+
+	wake, ok := l.nextWake(now)
+	require.Equal(t, true, ok)
+	require.Equal(t, now.Add(200*time.Millisecond), wake)
+
+	_, _, ok = l.popReady(now.Add(100 * time.Millisecond))
+	require.Equal(t, false, ok)
+
+	key, what, ok := l.popReady(now.Add(200 * time.Millisecond))
+	require.Equal(t, true, ok)
+	require.Equal(t, att, key)
+	require.Equal(t, 4, what)
+
+	_, _, ok = l.popReady(now.Add(400 * time.Millisecond))
+	require.Equal(t, false, ok)
+
+	key, what, ok = l.popReady(now.Add(500 * time.Millisecond))
+	require.Equal(t, true, ok)
+	require.Equal(t, hb, key)
+	require.Equal(t, 5, what)
+}
+
+func TestChannelRateLimiterByteRate(t *testing.T) {
+	l := newChannelRateLimiter(RateLimit{
+		ByteRate: 100,
+	}, 10)
+	now := l.tokensT
+	key := rateLimiterKey{1, 1, 0}
+
+	require.Equal(t, true, l.hasBudget(now))
+	writeNow, _ := l.push(key, 1, now)
+	require.Equal(t, true, writeNow)
+	l.onWritten(key, now, 150)
+
+	require.Equal(t, false, l.hasBudget(now))
+	wake, ok := l.nextWake(now)
+	require.Equal(t, true, ok)
+	require.Equal(t, now.Add(510*time.Millisecond), wake)
+
+	require.Equal(t, false, l.hasBudget(now.Add(500*time.Millisecond)))
+	require.Equal(t, true, l.hasBudget(now.Add(510*time.Millisecond)))
+}
+
+func TestChannelRateLimiterStateful(t *testing.T) {
+	l := newChannelRateLimiter(RateLimit{
+		DefaultRate: 1,
+	}, 10)
+	now := time.Now()
+	param := rateLimiterKey{1, 1, 22}
+
+	// messages of microservices are not limited by DefaultRate
+	for i := 0; i < 3; i++ {
+		writeNow, replaced := l.push(param, i, now)
+		require.Equal(t, true, writeNow)
+		require.Equal(t, false, replaced)
+		l.onWritten(param, now, 10)
+	}
+}
+
+func TestChannelRateLimiterHold(t *testing.T) {
+	l := newChannelRateLimiter(RateLimit{
+		MessageRates: map[uint32]float64{30: 5},
+		ByteRate:     100,
+	}, 2)
+	now := l.tokensT
+	att := rateLimiterKey{1, 1, 30}
+	param := rateLimiterKey{1, 1, 22}
+
+	l.onWritten(att, now, 150)
+	require.Equal(t, false, l.hasBudget(now))
+
+	// when the budget is over, limited messages are coalesced and the
+	// other ones are stored, discarding the oldest ones
+	replaced, dropped := l.hold(att, 1, PriorityNormal.index())
+	require.Equal(t, false, replaced)
+	require.Equal(t, false, dropped)
+	replaced, _ = l.hold(att, 2, PriorityNormal.index())
+	require.Equal(t, true, replaced)
+	for i := 3; i <= 5; i++ {
+		_, dropped = l.hold(param, i, PriorityNormal.index())
+		require.Equal(t, i == 5, dropped)
+	}
+
+	later := now.Add(time.Second)
+	require.Equal(t, true, l.hasBudget(later))
+	var written []interface{}
+	for {
+		_, what, ok := l.popReady(later)
+		if !ok {
+			break
+		}
+		written = append(written, what)
+	}
+	require.Equal(t, []interface{}{4, 5, 2}, written)
+}
+
+func TestChannelRateLimiterHoldPriority(t *testing.T) {
+	l := newChannelRateLimiter(RateLimit{
+		ByteRate: 100,
+	}, 3)
+	now := l.tokensT
+	cmd := rateLimiterKey{1, 1, 76}
+	param := rateLimiterKey{1, 1, 22}
+
+	l.onWritten(param, now, 150)
+	require.Equal(t, false, l.hasBudget(now))
+
+	_, dropped := l.hold(param, "normal1", PriorityNormal.index())
+	require.Equal(t, false, dropped)
+	_, dropped = l.hold(param, "low", PriorityLow.index())
+	require.Equal(t, false, dropped)
+	_, dropped = l.hold(param, "normal2", PriorityNormal.index())
+	require.Equal(t, false, dropped)
+
+	// lower priority items are discarded in favour of higher ones
+	_, dropped = l.hold(cmd, "high1", PriorityHigh.index())
+	require.Equal(t, true, dropped)
+	_, dropped = l.hold(cmd, "high2", PriorityHigh.index())
+	require.Equal(t, true, dropped)
+
+	// higher priority items are never discarded
+	_, dropped = l.hold(param, "low2", PriorityLow.index())
+	require.Equal(t, true, dropped)
+
+	later := now.Add(time.Second)
+	var written []interface{}
+	for {
+		_, what, ok := l.popReady(later)
+		if !ok {
+			break
+		}
+		written = append(written, what)
+	}
+	require.Equal(t, []interface{}{"high1", "high2", "normal2"}, written)
+}
+
+func TestNodeRateLimit(t *testing.T) {
+	msgs := []Message{&MessageAttitude{}, &MessageSystemTime{}}
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{EndpointOverride{
+			Endpoint: EndpointCustom{p1},
+			RateLimit: &RateLimit{
+				MessageRates: map[uint32]float64{30: 10},
+			},
+		}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+
+	ch := (<-node1.Events()).(*EventChannelOpen).Channel
+	go func() {
+		for range node1.Events() {
+		}
+	}()
+	<-node2.Events()
+
+	for i := 1; i <= 5; i++ {
+		node1.WriteMessageAll(&MessageAttitude{Roll: float32(i)})
+	}
+	node1.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 1})
+
+	// the first frame is written immediately, then unlimited messages,
+	// then the latest frame
+	evt := <-node2.Events()
+	require.Equal(t, &MessageAttitude{Roll: 1}, evt.(*EventFrame).Message())
+	evt = <-node2.Events()
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, evt.(*EventFrame).Message())
+	evt = <-node2.Events()
+	require.Equal(t, &MessageAttitude{Roll: 5}, evt.(*EventFrame).Message())
+	require.Equal(t, uint64(3), ch.Stats().FramesCoalesced)
+}
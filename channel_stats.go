@@ -0,0 +1,297 @@
+package gomavlib
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StreamStats contains the statistics of the frames received from a remote
+// system and component through a channel.
+type StreamStats struct {
+	// the system id of the sender
+	SystemId byte
+	// the component id of the sender
+	ComponentId byte
+	// the number of frames received, excluding duplicates
+	Received uint64
+	// the number of frames lost, computed from gaps in sequence numbers
+	Lost uint64
+	// the number of frames received twice or slightly out of order
+	Duplicates uint64
+}
+
+// LossPercent returns the percentage of frames lost.
+func (s *StreamStats) LossPercent() float64 {
+	if s.Received+s.Lost == 0 {
+		return 0
+	}
+	return float64(s.Lost) * 100 / float64(s.Received+s.Lost)
+}
+
+// ChannelStats contains the statistics of a channel.
+type ChannelStats struct {
+	// the number of frames received
+	FramesIn uint64
+	// the number of frames written
+	FramesOut uint64
+	// the number of bytes received
+	BytesIn uint64
+	// the number of bytes written
+	BytesOut uint64
+	// the number of parse errors
+	ParseErrors uint64
+	// the number of received frames discarded by the firewall
+	FramesBlockedIn uint64
+	// the number of outgoing frames discarded by the firewall
+	FramesBlockedOut uint64
+	// the number of outgoing frames replaced by newer ones because of
+	// rate limits
+	FramesCoalesced uint64
+	// the number of outgoing messages and frames that could not be encoded
+	// or written
+	WriteErrors uint64
+	// the number of received frames discarded since they had already been
+	// received through another channel (see DedupEnable)
+	DuplicatesSuppressed uint64
+	// the rate of received frames, in frames per second, computed over
+	// the last StatsPeriod
+	FrameRateIn float64
+	// the rate of written frames, in frames per second
+	FrameRateOut float64
+	// the rate of received bytes, in bytes per second
+	ByteRateIn float64
+	// the rate of written bytes, in bytes per second
+	ByteRateOut float64
+	// the statistics of each remote system and component, sorted by
+	// system id and component id
+	Streams []*StreamStats
+}
+
+// Received returns the number of frames received from all remote systems,
+// excluding duplicates.
+func (s *ChannelStats) Received() uint64 {
+	ret := uint64(0)
+	for _, st := range s.Streams {
+		ret += st.Received
+	}
+	return ret
+}
+
+// Lost returns the number of frames lost from all remote systems.
+func (s *ChannelStats) Lost() uint64 {
+	ret := uint64(0)
+	for _, st := range s.Streams {
+		ret += st.Lost
+	}
+	return ret
+}
+
+// LossPercent returns the percentage of frames lost from all remote systems.
+func (s *ChannelStats) LossPercent() float64 {
+	received, lost := s.Received(), s.Lost()
+	if received+lost == 0 {
+		return 0
+	}
+	return float64(lost) * 100 / float64(received+lost)
+}
+
+// the maximum distance behind the last sequence number of a stream within
+// which a frame is considered a duplicate or a frame out of order. Frames
+// that are further behind are considered the start of a new sequence, i.e.
+// the sender has been restarted or the link has been interrupted.
+const streamReorderWindow = 16
+
+type streamKey struct {
+	SystemId    byte
+	ComponentId byte
+}
+
+type streamState struct {
+	StreamStats
+	lastSequenceId byte
+}
+
+type channelStats struct {
+	mutex   sync.Mutex
+	cur     ChannelStats
+	prev    ChannelStats
+	prevT   time.Time
+	streams map[streamKey]*streamState
+}
+
+func newChannelStats() *channelStats {
+	return &channelStats{
+		prevT:   time.Now(),
+		streams: make(map[streamKey]*streamState),
+	}
+}
+
+func (s *channelStats) onBytesIn(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.BytesIn += uint64(n)
+}
+
+func (s *channelStats) onBytesOut(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.BytesOut += uint64(n)
+}
+
+func (s *channelStats) onParseError() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.ParseErrors++
+}
+
+func (s *channelStats) onFrameBlockedIn() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.FramesBlockedIn++
+}
+
+func (s *channelStats) onFrameBlockedOut() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.FramesBlockedOut++
+}
+
+func (s *channelStats) onDuplicateSuppressed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.DuplicatesSuppressed++
+}
+
+func (s *channelStats) onWriteError() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.WriteErrors++
+}
+
+func (s *channelStats) onFrameCoalesced() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.FramesCoalesced++
+}
+
+func (s *channelStats) getBytesOut() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cur.BytesOut
+}
+
+func (s *channelStats) onFrameOut() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur.FramesOut++
+}
+
+func (s *channelStats) onFrameIn(f Frame) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cur.FramesIn++
+
+	key := streamKey{f.GetSystemId(), f.GetComponentId()}
+	st, ok := s.streams[key]
+	if !ok {
+		s.streams[key] = &streamState{
+			StreamStats: StreamStats{
+				SystemId:    key.SystemId,
+				ComponentId: key.ComponentId,
+				Received:    1,
+			},
+			lastSequenceId: f.GetSequenceId(),
+		}
+		return
+	}
+
+	// sequence numbers wrap around at 256. A frame that is slightly behind the
+	// last one is considered a duplicate or a frame out of order.
+	delta := f.GetSequenceId() - st.lastSequenceId
+	if delta == 0 || delta > 255-streamReorderWindow {
+		st.Duplicates++
+		return
+	}
+
+	st.Received++
+	st.lastSequenceId = f.GetSequenceId()
+
+	// a frame that is far behind the last one starts a new sequence, and
+	// losses can't be computed
+	if delta > 128 {
+		return
+	}
+
+	st.Lost += uint64(delta - 1)
+}
+
+// update computes rates since the previous update.
+func (s *channelStats) update(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elapsed := now.Sub(s.prevT).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	s.cur.FrameRateIn = float64(s.cur.FramesIn-s.prev.FramesIn) / elapsed
+	s.cur.FrameRateOut = float64(s.cur.FramesOut-s.prev.FramesOut) / elapsed
+	s.cur.ByteRateIn = float64(s.cur.BytesIn-s.prev.BytesIn) / elapsed
+	s.cur.ByteRateOut = float64(s.cur.BytesOut-s.prev.BytesOut) / elapsed
+
+	s.prev = s.cur
+	s.prevT = now
+}
+
+func (s *channelStats) snapshot() *ChannelStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret := s.cur
+	ret.Streams = make([]*StreamStats, 0, len(s.streams))
+	for _, st := range s.streams {
+		cpy := st.StreamStats
+		ret.Streams = append(ret.Streams, &cpy)
+	}
+
+	sort.Slice(ret.Streams, func(i, j int) bool {
+		if ret.Streams[i].SystemId != ret.Streams[j].SystemId {
+			return ret.Streams[i].SystemId < ret.Streams[j].SystemId
+		}
+		return ret.Streams[i].ComponentId < ret.Streams[j].ComponentId
+	})
+
+	return &ret
+}
+
+// channelStatsReader counts the bytes read from a channel.
+type channelStatsReader struct {
+	r     io.Reader
+	stats *channelStats
+}
+
+func (r *channelStatsReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.stats.onBytesIn(n)
+	}
+	return n, err
+}
+
+// channelStatsWriter counts the bytes written to a channel.
+type channelStatsWriter struct {
+	w     io.Writer
+	stats *channelStats
+}
+
+func (w *channelStatsWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.stats.onBytesOut(n)
+	}
+	return n, err
+}
@@ -0,0 +1,95 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelStatsSequence(t *testing.T) {
+	s := newChannelStats()
+
+	for _, seq := range []byte{250, 251, 253, 253, 255, 2, 1, 3} {
+		s.onFrameIn(&FrameV2{SequenceId: seq, SystemId: 1, ComponentId: 1})
+	}
+	s.onFrameIn(&FrameV2{SequenceId: 0, SystemId: 2, ComponentId: 1})
+
+	st := s.snapshot()
+	require.Equal(t, uint64(9), st.FramesIn)
+	require.Equal(t, []*StreamStats{
+		{SystemId: 1, ComponentId: 1, Received: 6, Lost: 4, Duplicates: 2},
+		{SystemId: 2, ComponentId: 1, Received: 1},
+	}, st.Streams)
+	require.Equal(t, float64(40), st.Streams[0].LossPercent())
+	require.Equal(t, uint64(7), st.Received())
+	require.Equal(t, uint64(4), st.Lost())
+	require.Equal(t, float64(4)*100/11, st.LossPercent())
+}
+
+func TestChannelStatsSequenceReset(t *testing.T) {
+	s := newChannelStats()
+
+	// the sender is restarted and its sequence starts again from zero
+	for _, seq := range []byte{100, 101, 102, 0, 1, 2, 2, 4} {
+		s.onFrameIn(&FrameV2{SequenceId: seq, SystemId: 1, ComponentId: 1})
+	}
+
+	st := s.snapshot()
+	require.Equal(t, []*StreamStats{
+		{SystemId: 1, ComponentId: 1, Received: 7, Lost: 1, Duplicates: 1},
+	}, st.Streams)
+}
+
+func TestNodeStats(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		StatsPeriod:      100 * time.Millisecond,
+		StatsEventEnable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+	go func() {
+		for range node2.Events() {
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		node2.WriteMessageAll(&MessageHeartbeat{})
+	}
+
+	var in *ChannelStats
+	for evt := range node1.Events() {
+		if ee, ok := evt.(*EventChannelStats); ok && ee.Stats.FramesIn == 5 {
+			in = ee.Stats
+			break
+		}
+	}
+	require.Equal(t, uint64(5), in.Received())
+	require.Equal(t, uint64(0), in.Lost())
+	require.Equal(t, uint64(0), in.ParseErrors)
+
+	stats := node2.Stats()
+	require.Equal(t, 1, len(stats))
+	for _, out := range stats {
+		require.Equal(t, uint64(5), out.FramesOut)
+		require.Equal(t, out.BytesOut, in.BytesIn)
+	}
+}
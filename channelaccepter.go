@@ -5,14 +5,16 @@ import (
 )
 
 type channelAccepter struct {
-	n   *Node
-	eca endpointChannelAccepter
+	n     *Node
+	eca   endpointChannelAccepter
+	proto *channelProtocol
 }
 
-func newChannelAccepter(n *Node, eca endpointChannelAccepter) (*channelAccepter, error) {
+func newChannelAccepter(n *Node, eca endpointChannelAccepter, proto *channelProtocol) (*channelAccepter, error) {
 	return &channelAccepter{
-		n:   n,
-		eca: eca,
+		n:     n,
+		eca:   eca,
+		proto: proto,
 	}, nil
 }
 
@@ -30,7 +32,7 @@ func (ca *channelAccepter) run() {
 			break
 		}
 
-		ch, err := newChannel(ca.n, ca.eca, label, rwc)
+		ch, err := newChannel(ca.n, ca.eca, ca.proto, label, rwc)
 		if err != nil {
 			panic(fmt.Errorf("newChannel unexpected error: %s", err))
 		}
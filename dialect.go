@@ -2,10 +2,12 @@ package gomavlib
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // DialectFieldType enum
@@ -88,6 +90,85 @@ type Dialect interface {
 	getMsgById(id uint32) (*dialectMessage, bool)
 }
 
+// dialectHasMessage checks whether a message exists in a dialect and
+// corresponds to the standard, by comparing its CRC extra.
+func dialectHasMessage(d Dialect, id uint32, crcExtra byte) bool {
+	if d == nil {
+		return false
+	}
+	mp, ok := d.getMsgById(id)
+	return ok && (*mp).getCRCExtra() == crcExtra
+}
+
+// dialectNewMessage allocates an empty message of given id.
+// The message must exist in the dialect.
+func dialectNewMessage(d Dialect, id uint32) Message {
+	mp, _ := d.getMsgById(id)
+	return (*mp).newMsg()
+}
+
+// dialectConvertCache contains the definitions of the static messages that
+// have been converted by dialectConvertMessage(), indexed by type.
+var dialectConvertCache sync.Map
+
+// dialectConvertMessage converts a message that belongs to another dialect
+// into the corresponding message of d, by encoding it with its own definition
+// and decoding it with the definition of d. Messages that already belong to d
+// and raw messages are returned as they are.
+func dialectConvertMessage(d Dialect, msg Message) (Message, error) {
+	if _, ok := msg.(*MessageRaw); ok || msg == nil || d == nil {
+		return msg, nil
+	}
+
+	mp, ok := d.getMsgById(msg.GetId())
+	if ok == false {
+		return nil, fmt.Errorf("message cannot be encoded since it is not in the dialect")
+	}
+
+	switch tmp := (*mp).(type) {
+	case *DialectMessageCT:
+		if reflect.TypeOf(msg) == reflect.PtrTo(tmp.elemType) {
+			return msg, nil
+		}
+
+	case *DialectMessageRT:
+		if dm, ok := msg.(*DynamicMessage); ok && dm.T == tmp {
+			return msg, nil
+		}
+	}
+
+	var src dialectMessage
+	if dm, ok := msg.(*DynamicMessage); ok {
+		if dm.T == nil {
+			return nil, fmt.Errorf("dynamic message has no definition")
+		}
+		src = dm.T
+
+	} else {
+		typ := reflect.TypeOf(msg)
+		if cached, ok := dialectConvertCache.Load(typ); ok {
+			src = cached.(*DialectMessageCT)
+		} else {
+			smp, err := newDialectMessage(msg)
+			if err != nil {
+				return nil, err
+			}
+			dialectConvertCache.Store(typ, smp)
+			src = smp
+		}
+	}
+
+	if src.getCRCExtra() != (*mp).getCRCExtra() {
+		return nil, fmt.Errorf("message cannot be converted since its definition differs from the one of the dialect")
+	}
+
+	buf, err := src.encode(msg, true)
+	if err != nil {
+		return nil, err
+	}
+	return (*mp).decode(buf, true)
+}
+
 type DialectMessageField struct {
 	isEnum      bool
 	ftype       DialectFieldType
@@ -312,6 +312,11 @@ func (mp *DialectMessageCT) decode(buf []byte, isFrameV2 bool) (Message, error)
 }
 
 func (mp *DialectMessageCT) encode(msg Message, isFrameV2 bool) ([]byte, error) {
+	// make sure the message matches the type of the dialect message
+	if reflect.TypeOf(msg) != reflect.PtrTo(mp.elemType) {
+		return nil, fmt.Errorf("wrong message type (%T)", msg)
+	}
+
 	var buf []byte
 
 	if isFrameV2 == true {
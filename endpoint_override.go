@@ -0,0 +1,111 @@
+package gomavlib
+
+import (
+	"fmt"
+)
+
+// EndpointOverride wraps the configuration of an endpoint and overrides the
+// protocol options of NodeConf in all the channels of the endpoint.
+// Options that are not provided are inherited from NodeConf.
+type EndpointOverride struct {
+	// the configuration of the endpoint
+	Endpoint EndpointConf
+
+	// (optional) the dialect used to encode and decode messages.
+	// Outgoing messages that belong to another dialect, like the ones
+	// created by the node with the dialect of NodeConf, are converted into
+	// this dialect. Messages that are missing or defined differently are
+	// discarded and counted in ChannelStats.WriteErrors.
+	// Incoming messages are decoded with this dialect, therefore node
+	// features (heartbeats, commands, stream requests, etc) require it to
+	// contain the messages they use.
+	D Dialect
+
+	// (optional) the accepted frame version. Frames with a different
+	// version are discarded.
+	InVersion Version
+	// (optional) the secret key used to validate incoming frames.
+	InKey *Key
+	// (optional) disables the validation of incoming frames through the
+	// InKey of NodeConf.
+	InKeyDisable bool
+
+	// (optional) Mavlink version used to encode messages.
+	OutVersion Version
+	// (optional) the secret key used to sign outgoing frames.
+	OutKey *Key
+	// (optional) disables the signature of outgoing frames through the
+	// OutKey of NodeConf.
+	OutKeyDisable bool
+
+	// (optional) the firewall applied to the channels of the endpoint.
+	Firewall *Firewall
+
+	// (optional) the limits applied to the frames written to the channels
+	// of the endpoint.
+	RateLimit *RateLimit
+}
+
+func (conf EndpointOverride) init() (Endpoint, error) {
+	if conf.Endpoint == nil {
+		return nil, fmt.Errorf("endpoint not provided")
+	}
+	return conf.Endpoint.init()
+}
+
+// channelProtocol contains the protocol options of the channels of an endpoint.
+type channelProtocol struct {
+	d          Dialect
+	inVersion  Version
+	inKey      *Key
+	outVersion Version
+	outKey     *Key
+	firewall   *Firewall
+	rateLimit  *RateLimit
+	link       *Link
+	linkIndex  int
+}
+
+func newChannelProtocol(nconf NodeConf, tconf EndpointConf) (*channelProtocol, error) {
+	p := &channelProtocol{
+		d:          nconf.D,
+		inVersion:  nconf.InVersion,
+		inKey:      nconf.InKey,
+		outVersion: nconf.OutVersion,
+		outKey:     nconf.OutKey,
+	}
+
+	if o, ok := tconf.(EndpointOverride); ok {
+		if o.D != nil {
+			p.d = o.D
+		}
+		if o.InVersion != 0 {
+			p.inVersion = o.InVersion
+		}
+		if o.InKeyDisable {
+			p.inKey = nil
+		} else if o.InKey != nil {
+			p.inKey = o.InKey
+		}
+		if o.OutVersion != 0 {
+			p.outVersion = o.OutVersion
+		}
+		if o.OutKeyDisable {
+			p.outKey = nil
+		} else if o.OutKey != nil {
+			p.outKey = o.OutKey
+		}
+		p.firewall = o.Firewall
+		p.rateLimit = o.RateLimit
+	}
+
+	// check Parser configuration here, since Parser is created dynamically
+	if p.inKey != nil && p.inVersion == V1 {
+		return nil, fmt.Errorf("InKey requires V2 frames")
+	}
+	if p.outKey != nil && p.outVersion == V1 {
+		return nil, fmt.Errorf("OutKey requires V2 frames")
+	}
+
+	return p, nil
+}
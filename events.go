@@ -19,12 +19,22 @@ func (*eventInChannelClosed) isEventIn() {}
 type eventInWriteTo struct {
 	ch   *Channel
 	what interface{}
+	res  chan *pendingWrite
 }
 
 func (*eventInWriteTo) isEventIn() {}
 
+type eventInTryWriteTo struct {
+	ch   *Channel
+	what interface{}
+	res  chan error
+}
+
+func (*eventInTryWriteTo) isEventIn() {}
+
 type eventInWriteAll struct {
 	what interface{}
+	res  chan *pendingWrite
 }
 
 func (*eventInWriteAll) isEventIn() {}
@@ -32,10 +42,40 @@ func (*eventInWriteAll) isEventIn() {}
 type eventInWriteExcept struct {
 	except *Channel
 	what   interface{}
+	res    chan *pendingWrite
 }
 
 func (*eventInWriteExcept) isEventIn() {}
 
+type eventInWriteRouted struct {
+	except *Channel
+	what   interface{}
+	res    chan *pendingWrite
+}
+
+func (*eventInWriteRouted) isEventIn() {}
+
+type eventInAddEndpoint struct {
+	ca  *channelAccepter
+	ch  *Channel
+	res chan error
+}
+
+func (*eventInAddEndpoint) isEventIn() {}
+
+type eventInRemoveEndpoint struct {
+	e   Endpoint
+	res chan error
+}
+
+func (*eventInRemoveEndpoint) isEventIn() {}
+
+type eventInChannels struct {
+	res chan []*Channel
+}
+
+func (*eventInChannels) isEventIn() {}
+
 type eventInClose struct {
 }
 
@@ -110,6 +150,141 @@ type EventStreamRequested struct {
 	SystemId byte
 	// the component id to which the stream requests is addressed
 	ComponentId byte
+	// the ids of the messages whose interval was not accepted by the target,
+	// in StreamRequestMessageInterval mode
+	Rejected []uint32
 }
 
 func (*EventStreamRequested) isEventOut() {}
+
+// EventChannelStats is the event fired periodically with the statistics
+// of a channel, when StatsEventEnable is true.
+type EventChannelStats struct {
+	// the channel
+	Channel *Channel
+	// the statistics of the channel
+	Stats *ChannelStats
+}
+
+func (*EventChannelStats) isEventOut() {}
+
+// EventLinkChange is the event fired when the active channel of a link changes.
+type EventLinkChange struct {
+	// the link
+	Link *Link
+	// the new active channel, or nil if the link has no open channels
+	Channel *Channel
+}
+
+func (*EventLinkChange) isEventOut() {}
+
+// EventSystemAppeared is the event fired when a heartbeat is received from
+// a system or component that was not known.
+type EventSystemAppeared struct {
+	// the channel from which the heartbeat was received
+	Channel *Channel
+	// the system id of the remote system
+	SystemId byte
+	// the component id of the remote system
+	ComponentId byte
+	// the type of the remote system (MAV_TYPE)
+	Type uint8
+	// the autopilot type of the remote system (MAV_AUTOPILOT)
+	Autopilot uint8
+}
+
+func (*EventSystemAppeared) isEventOut() {}
+
+// EventSystemLost is the event fired when a known system or component
+// has not sent heartbeats for HeartbeatTimeout.
+type EventSystemLost struct {
+	// the channel from which the last heartbeat was received
+	Channel *Channel
+	// the system id of the remote system
+	SystemId byte
+	// the component id of the remote system
+	ComponentId byte
+}
+
+func (*EventSystemLost) isEventOut() {}
+
+// EventCommandProgress is the event fired when the target of a command
+// reports that the command is in progress.
+type EventCommandProgress struct {
+	// the channel from which the progress update was received
+	Channel *Channel
+	// the system id of the target
+	SystemId byte
+	// the component id of the target
+	ComponentId byte
+	// the command id
+	Command uint16
+	// the progress percentage
+	Progress uint8
+}
+
+func (*EventCommandProgress) isEventOut() {}
+
+// EventParamChange is the event fired when a ParamClient detects that the
+// value of a parameter of its target has changed.
+type EventParamChange struct {
+	// the channel from which the new value was received
+	Channel *Channel
+	// the system id of the target
+	SystemId byte
+	// the component id of the target
+	ComponentId byte
+	// the parameter, with its new value
+	Param *Param
+	// the previous value of the parameter
+	Previous float64
+}
+
+func (*EventParamChange) isEventOut() {}
+
+// EventParamSet is the event fired when a client changes a parameter
+// of a ParamServer.
+type EventParamSet struct {
+	// the channel from which the request was received
+	Channel *Channel
+	// the system id of the client
+	SystemId byte
+	// the component id of the client
+	ComponentId byte
+	// the parameter, with its new value
+	Param *Param
+	// the previous value of the parameter
+	Previous float64
+}
+
+func (*EventParamSet) isEventOut() {}
+
+// EventMissionChange is the event fired when a client uploads or clears
+// a mission of a MissionServer.
+type EventMissionChange struct {
+	// the channel from which the mission was received
+	Channel *Channel
+	// the system id of the client
+	SystemId byte
+	// the component id of the client
+	ComponentId byte
+	// the type of the mission
+	MissionType MissionType
+}
+
+func (*EventMissionChange) isEventOut() {}
+
+// EventMissionSetCurrent is the event fired when a client changes the
+// current item of a MissionServer.
+type EventMissionSetCurrent struct {
+	// the channel from which the request was received
+	Channel *Channel
+	// the system id of the client
+	SystemId byte
+	// the component id of the client
+	ComponentId byte
+	// the sequence number of the new current item
+	Seq uint16
+}
+
+func (*EventMissionSetCurrent) isEventOut() {}
@@ -32,8 +32,11 @@ func main() {
 		if frm, ok := evt.(*gomavlib.EventFrame); ok {
 			fmt.Printf("received: id=%d, %+v\n", frm.Message().GetId(), frm.Message())
 
-			// route frame to every other channel
-			node.WriteFrameExcept(frm.Channel, frm.Frame)
+			// route frame to the channels where its target has been seen,
+			// or to every other channel if the frame has no target.
+			// Frames can be routed by target only if they can be decoded
+			// with the dialect, otherwise they are routed to every other channel.
+			node.WriteFrameRouted(frm.Channel, frm.Frame)
 		}
 	}
 }
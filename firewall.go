@@ -0,0 +1,199 @@
+package gomavlib
+
+// FirewallAction is the action applied to the frames that match a FirewallRule.
+type FirewallAction int
+
+const (
+	// FirewallAllow lets frames pass.
+	FirewallAllow FirewallAction = iota
+	// FirewallDeny discards frames.
+	FirewallDeny
+)
+
+// FirewallSignature selects frames by their signature.
+type FirewallSignature int
+
+const (
+	// FirewallSignatureAny matches both signed and unsigned frames.
+	FirewallSignatureAny FirewallSignature = iota
+	// FirewallSigned matches signed frames only. Incoming frames are
+	// considered signed only when their signature has been validated with
+	// the InKey of the channel; on channels without InKey, they never match.
+	FirewallSigned
+	// FirewallUnsigned matches unsigned frames only.
+	FirewallUnsigned
+)
+
+// FirewallRule is a rule of a Firewall. A frame matches the rule when it
+// matches all the non-empty fields of the rule.
+// TargetSystemIds, TargetComponentIds and Commands require the message to be
+// decoded. When it can't be decoded (i.e. the dialect is nil or doesn't
+// contain the message), these fields are unknown: deny rules match, in order
+// to fail closed, while allow rules don't. Use MessageIds to restrict deny
+// rules to the messages that contain these fields.
+type FirewallRule struct {
+	// the action applied to matching frames
+	Action FirewallAction
+	// (optional) the message ids
+	MessageIds []uint32
+	// (optional) the system ids of the senders
+	SystemIds []byte
+	// (optional) the component ids of the senders
+	ComponentIds []byte
+	// (optional) the values of the target_system field.
+	// Messages without a target do not match.
+	TargetSystemIds []byte
+	// (optional) the values of the target_component field.
+	// Messages without a target do not match.
+	TargetComponentIds []byte
+	// (optional) the commands (MAV_CMD) contained in COMMAND_LONG and
+	// COMMAND_INT. Other messages do not match.
+	Commands []uint16
+	// (optional) the signature status of frames
+	Signature FirewallSignature
+}
+
+// Firewall contains the rules that allow or deny the frames of a channel.
+// Rules are evaluated in order and the action of the first rule that matches
+// a frame is applied. Incoming frames are filtered before being processed
+// and emitted, outgoing frames before being written.
+type Firewall struct {
+	// (optional) the rules applied to incoming frames
+	In []FirewallRule
+	// (optional) the action applied to incoming frames that do not match
+	// any rule. It defaults to FirewallAllow.
+	InDefault FirewallAction
+	// (optional) the rules applied to outgoing frames
+	Out []FirewallRule
+	// (optional) the action applied to outgoing frames that do not match
+	// any rule. It defaults to FirewallAllow.
+	OutDefault FirewallAction
+}
+
+// firewallPacket contains the properties of a frame that are checked by rules.
+type firewallPacket struct {
+	msg         Message
+	systemId    byte
+	componentId byte
+	signed      bool
+}
+
+// newFirewallPacket returns the properties of a frame. Since the signed flag
+// can be set by anyone, the frame is considered signed only if its signature
+// has been validated.
+func newFirewallPacket(f Frame, validated bool) *firewallPacket {
+	ff, isV2 := f.(*FrameV2)
+	return &firewallPacket{
+		msg:         f.GetMessage(),
+		systemId:    f.GetSystemId(),
+		componentId: f.GetComponentId(),
+		signed:      validated && isV2 && ff.IsSigned(),
+	}
+}
+
+func firewallMatchByte(vals []byte, v byte) bool {
+	for _, val := range vals {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+// firewallMatchField checks whether a field of a message has one of the given
+// values. If the message is not decoded, the field is unknown and unknown is
+// returned.
+func firewallMatchField(vals []byte, msg Message, name string, unknown bool) bool {
+	if _, ok := msg.(*MessageRaw); ok {
+		return unknown
+	}
+	v, ok := messageFieldUint(msg, name)
+	return ok && firewallMatchByte(vals, byte(v))
+}
+
+func (r *FirewallRule) match(p *firewallPacket) bool {
+	// fields that can't be read match deny rules only
+	unknown := r.Action == FirewallDeny
+
+	if len(r.MessageIds) > 0 {
+		found := false
+		for _, id := range r.MessageIds {
+			if p.msg.GetId() == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.SystemIds) > 0 && !firewallMatchByte(r.SystemIds, p.systemId) {
+		return false
+	}
+
+	if len(r.ComponentIds) > 0 && !firewallMatchByte(r.ComponentIds, p.componentId) {
+		return false
+	}
+
+	if len(r.TargetSystemIds) > 0 && !firewallMatchField(r.TargetSystemIds, p.msg, "target_system", unknown) {
+		return false
+	}
+
+	if len(r.TargetComponentIds) > 0 && !firewallMatchField(r.TargetComponentIds, p.msg, "target_component", unknown) {
+		return false
+	}
+
+	if len(r.Commands) > 0 {
+		// COMMAND_INT, COMMAND_LONG
+		if p.msg.GetId() != 75 && p.msg.GetId() != 76 {
+			return false
+		}
+		if _, ok := p.msg.(*MessageRaw); ok {
+			if !unknown {
+				return false
+			}
+		} else {
+			cmd, ok := messageFieldUint(p.msg, "command")
+			if !ok {
+				return false
+			}
+			found := false
+			for _, c := range r.Commands {
+				if uint64(c) == cmd {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	switch r.Signature {
+	case FirewallSigned:
+		return p.signed
+	case FirewallUnsigned:
+		return !p.signed
+	}
+
+	return true
+}
+
+func firewallAllows(rules []FirewallRule, def FirewallAction, p *firewallPacket) bool {
+	for i := range rules {
+		if rules[i].match(p) {
+			return rules[i].Action == FirewallAllow
+		}
+	}
+	return def == FirewallAllow
+}
+
+func (fw *Firewall) allowsIn(p *firewallPacket) bool {
+	return firewallAllows(fw.In, fw.InDefault, p)
+}
+
+func (fw *Firewall) allowsOut(p *firewallPacket) bool {
+	return firewallAllows(fw.Out, fw.OutDefault, p)
+}
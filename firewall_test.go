@@ -0,0 +1,234 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewallRule(t *testing.T) {
+	arm := &firewallPacket{
+		msg: &MessageCommandLong{
+			TargetSystem:    1,
+			TargetComponent: 1,
+			Command:         MAV_CMD_COMPONENT_ARM_DISARM,
+		},
+		systemId:    255,
+		componentId: 190,
+	}
+	attitude := &firewallPacket{
+		msg:         &MessageAttitude{},
+		systemId:    1,
+		componentId: 1,
+		signed:      true,
+	}
+
+	for _, ca := range []struct {
+		name     string
+		rule     FirewallRule
+		arm      bool
+		attitude bool
+	}{
+		{"empty", FirewallRule{}, true, true},
+		{"message id", FirewallRule{MessageIds: []uint32{30}}, false, true},
+		{"system id", FirewallRule{SystemIds: []byte{255}}, true, false},
+		{"component id", FirewallRule{ComponentIds: []byte{1, 2}}, false, true},
+		{"target system", FirewallRule{TargetSystemIds: []byte{1}}, true, false},
+		{"target component", FirewallRule{TargetComponentIds: []byte{2}}, false, false},
+		{"command", FirewallRule{Commands: []uint16{400}}, true, false},
+		{"signed", FirewallRule{Signature: FirewallSigned}, false, true},
+		{"unsigned", FirewallRule{Signature: FirewallUnsigned}, true, false},
+		{"multiple", FirewallRule{SystemIds: []byte{255}, Commands: []uint16{401}}, false, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.arm, ca.rule.match(arm))
+			require.Equal(t, ca.attitude, ca.rule.match(attitude))
+		})
+	}
+
+	fw := &Firewall{
+		In: []FirewallRule{
+			{Action: FirewallAllow, MessageIds: []uint32{30}},
+		},
+		InDefault: FirewallDeny,
+	}
+	require.Equal(t, false, fw.allowsIn(arm))
+	require.Equal(t, true, fw.allowsIn(attitude))
+	require.Equal(t, true, fw.allowsOut(arm))
+}
+
+func TestFirewallRuleUndecoded(t *testing.T) {
+	arm := &firewallPacket{
+		msg:         &MessageRaw{Id: 76, Content: make([]byte, 33)},
+		systemId:    255,
+		componentId: 190,
+	}
+
+	// fields of undecoded messages match deny rules only
+	for _, ca := range []struct {
+		name string
+		rule FirewallRule
+	}{
+		{"target system", FirewallRule{TargetSystemIds: []byte{1}}},
+		{"target component", FirewallRule{TargetComponentIds: []byte{1}}},
+		{"command", FirewallRule{Commands: []uint16{400}}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			rule := ca.rule
+			rule.Action = FirewallAllow
+			require.Equal(t, false, rule.match(arm))
+			rule.Action = FirewallDeny
+			require.Equal(t, true, rule.match(arm))
+		})
+	}
+
+	// other messages are still excluded by command rules
+	require.Equal(t, false, (&FirewallRule{Action: FirewallDeny, Commands: []uint16{400}}).match(
+		&firewallPacket{msg: &MessageRaw{Id: 30}}))
+
+	fw := &Firewall{
+		In: []FirewallRule{
+			{Action: FirewallDeny, Commands: []uint16{400}},
+		},
+	}
+	require.Equal(t, false, fw.allowsIn(arm))
+}
+
+func TestNodeFirewall(t *testing.T) {
+	msgs := []Message{&MessageAttitude{}, &MessageCommandLong{}, &MessageParamSet{}}
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{EndpointOverride{
+			Endpoint: EndpointCustom{p1},
+			Firewall: &Firewall{
+				In: []FirewallRule{
+					{Action: FirewallDeny, MessageIds: []uint32{23}},
+					{Action: FirewallDeny, Commands: []uint16{uint16(MAV_CMD_COMPONENT_ARM_DISARM)}},
+				},
+				Out: []FirewallRule{
+					{Action: FirewallDeny, MessageIds: []uint32{30}},
+				},
+			},
+		}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+
+	ch := (<-node1.Events()).(*EventChannelOpen).Channel
+	<-node2.Events()
+
+	// inbound
+	node2.WriteMessageAll(&MessageParamSet{TargetSystem: 10})
+	node2.WriteMessageAll(&MessageCommandLong{TargetSystem: 10, Command: MAV_CMD_COMPONENT_ARM_DISARM})
+	node2.WriteMessageAll(&MessageCommandLong{TargetSystem: 10, Command: MAV_CMD_NAV_TAKEOFF})
+	node2.WriteMessageAll(&MessageAttitude{Roll: 1})
+
+	evt := <-node1.Events()
+	require.Equal(t, MAV_CMD_NAV_TAKEOFF, evt.(*EventFrame).Message().(*MessageCommandLong).Command)
+	evt = <-node1.Events()
+	require.Equal(t, &MessageAttitude{Roll: 1}, evt.(*EventFrame).Message())
+	require.Equal(t, uint64(2), ch.Stats().FramesBlockedIn)
+
+	// outbound
+	node1.WriteMessageAll(&MessageAttitude{Roll: 2})
+	node1.WriteMessageAll(&MessageParamSet{TargetSystem: 11})
+	evt = <-node2.Events()
+	require.IsType(t, &MessageParamSet{}, evt.(*EventFrame).Message())
+	require.Equal(t, uint64(1), ch.Stats().FramesBlockedOut)
+
+	// the firewall can be replaced at runtime
+	ch.SetFirewall(nil)
+	node2.WriteMessageAll(&MessageParamSet{TargetSystem: 10})
+	evt = <-node1.Events()
+	require.IsType(t, &MessageParamSet{}, evt.(*EventFrame).Message())
+}
+
+func TestNodeFirewallForgedSignature(t *testing.T) {
+	msgs := []Message{&MessageAttitude{}}
+	key := NewKey([]byte("0123456789012345678901234567890"))
+	forgedKey := NewKey([]byte("abcdefghijklmnopqrstuvwxyzabcde"))
+
+	for _, ca := range []struct {
+		name    string
+		inKey   *Key
+		allowed bool
+	}{
+		{"no in key", nil, false},
+		{"in key", key, true},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			node1, err := NewNode(NodeConf{
+				D:           MustDialectCT(3, msgs),
+				OutVersion:  V2,
+				OutSystemId: 10,
+				Endpoints: []EndpointConf{EndpointOverride{
+					Endpoint: EndpointCustom{p1},
+					Firewall: &Firewall{
+						In: []FirewallRule{
+							{Action: FirewallAllow, Signature: FirewallSigned},
+						},
+						InDefault: FirewallDeny,
+					},
+				}},
+				InKey:            ca.inKey,
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node1.Close()
+
+			// without InKey, frames signed with any key must not be
+			// considered signed
+			outKey := forgedKey
+			if ca.inKey != nil {
+				outKey = ca.inKey
+			}
+
+			node2, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      11,
+				OutKey:           outKey,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node2.Close()
+
+			ch := (<-node1.Events()).(*EventChannelOpen).Channel
+			<-node2.Events()
+
+			node2.WriteMessageAll(&MessageAttitude{Roll: 1})
+
+			if ca.allowed {
+				evt := <-node1.Events()
+				require.Equal(t, &MessageAttitude{Roll: 1}, evt.(*EventFrame).Message())
+			} else {
+				select {
+				case evt := <-node1.Events():
+					t.Fatalf("unexpected event: %T", evt)
+				case <-time.After(500 * time.Millisecond):
+				}
+				require.Equal(t, uint64(1), ch.Stats().FramesBlockedIn)
+			}
+		})
+	}
+}
@@ -0,0 +1,849 @@
+package gomavlib
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// size of the payload of FILE_TRANSFER_PROTOCOL
+	_FTP_PAYLOAD_SIZE = 251
+	// size of the header of the FTP payload
+	_FTP_HEADER_SIZE = 12
+	// maximum size of the data carried by a FTP payload
+	_FTP_DATA_SIZE = _FTP_PAYLOAD_SIZE - _FTP_HEADER_SIZE
+	// maximum number of chunks kept in memory during a download
+	_FTP_DOWNLOAD_MAX_PENDING = 64
+)
+
+// FTP opcodes
+const (
+	_FTP_OP_TERMINATE_SESSION = 1
+	_FTP_OP_RESET_SESSIONS    = 2
+	_FTP_OP_LIST_DIRECTORY    = 3
+	_FTP_OP_OPEN_FILE_RO      = 4
+	_FTP_OP_READ_FILE         = 5
+	_FTP_OP_CREATE_FILE       = 6
+	_FTP_OP_WRITE_FILE        = 7
+	_FTP_OP_REMOVE_FILE       = 8
+	_FTP_OP_CREATE_DIRECTORY  = 9
+	_FTP_OP_REMOVE_DIRECTORY  = 10
+	_FTP_OP_OPEN_FILE_WO      = 11
+	_FTP_OP_TRUNCATE_FILE     = 12
+	_FTP_OP_RENAME            = 13
+	_FTP_OP_CALC_FILE_CRC32   = 14
+	_FTP_OP_BURST_READ_FILE   = 15
+	_FTP_OP_ACK               = 128
+	_FTP_OP_NAK               = 129
+)
+
+// FTP error codes
+const (
+	_FTP_ERR_FAIL_ERRNO = 2
+	_FTP_ERR_EOF        = 6
+)
+
+var ftpErrorNames = map[uint8]string{
+	1:  "failed",
+	2:  "failed with errno",
+	3:  "invalid data size",
+	4:  "invalid session",
+	5:  "no sessions available",
+	6:  "end of file",
+	7:  "unknown command",
+	8:  "file exists",
+	9:  "file protected",
+	10: "file not found",
+}
+
+// FtpError is the error returned when the target refuses a FTP request.
+type FtpError struct {
+	// the error code sent by the target
+	Code uint8
+	// the errno, when Code is 2 (FailErrno)
+	Errno uint8
+}
+
+// Error implements the error interface.
+func (e *FtpError) Error() string {
+	name, ok := ftpErrorNames[e.Code]
+	if !ok {
+		name = "error " + strconv.FormatUint(uint64(e.Code), 10)
+	}
+	if e.Code == _FTP_ERR_FAIL_ERRNO {
+		return fmt.Sprintf("ftp: %s %d", name, e.Errno)
+	}
+	return "ftp: " + name
+}
+
+// ftpPayload is the content of the payload field of FILE_TRANSFER_PROTOCOL.
+type ftpPayload struct {
+	seq           uint16
+	session       uint8
+	opcode        uint8
+	reqOpcode     uint8
+	burstComplete uint8
+	offset        uint32
+	data          []byte
+}
+
+func (p *ftpPayload) encode() []byte {
+	buf := make([]byte, _FTP_PAYLOAD_SIZE)
+	binary.LittleEndian.PutUint16(buf[0:], p.seq)
+	buf[2] = p.session
+	buf[3] = p.opcode
+	buf[4] = uint8(len(p.data))
+	buf[5] = p.reqOpcode
+	buf[6] = p.burstComplete
+	binary.LittleEndian.PutUint32(buf[8:], p.offset)
+	copy(buf[_FTP_HEADER_SIZE:], p.data)
+	return buf
+}
+
+func (p *ftpPayload) decode(buf []byte) error {
+	if len(buf) < _FTP_HEADER_SIZE {
+		return fmt.Errorf("invalid payload size")
+	}
+
+	p.seq = binary.LittleEndian.Uint16(buf[0:])
+	p.session = buf[2]
+	p.opcode = buf[3]
+	size := int(buf[4])
+	p.reqOpcode = buf[5]
+	p.burstComplete = buf[6]
+	p.offset = binary.LittleEndian.Uint32(buf[8:])
+
+	if size > len(buf)-_FTP_HEADER_SIZE {
+		return fmt.Errorf("invalid data size")
+	}
+	p.data = buf[_FTP_HEADER_SIZE : _FTP_HEADER_SIZE+size]
+	return nil
+}
+
+// err returns the error contained in a NAK.
+func (p *ftpPayload) err() error {
+	if p.opcode != _FTP_OP_NAK {
+		return nil
+	}
+	e := &FtpError{}
+	if len(p.data) > 0 {
+		e.Code = p.data[0]
+	}
+	if len(p.data) > 1 {
+		e.Errno = p.data[1]
+	}
+	return e
+}
+
+func isFtpEOF(err error) bool {
+	e, ok := err.(*FtpError)
+	return ok && e.Code == _FTP_ERR_EOF
+}
+
+// ftpCRC32 computes the CRC32 used by the FTP protocol, that has initial
+// value 0 and no final xor.
+func ftpCRC32(crc uint32, data []byte) uint32 {
+	return ^crc32.Update(^crc, crc32.IEEETable, data)
+}
+
+func ftpPath(path string) ([]byte, error) {
+	if len(path) > _FTP_DATA_SIZE {
+		return nil, fmt.Errorf("path is too long")
+	}
+	return []byte(path), nil
+}
+
+// FtpEntry is an entry of a remote directory.
+type FtpEntry struct {
+	// the entry name
+	Name string
+	// whether the entry is a directory
+	IsDir bool
+	// the file size
+	Size uint32
+}
+
+// FtpClientConf allows to configure a FtpClient.
+type FtpClientConf struct {
+	// the node used to communicate with the target.
+	Node *Node
+
+	// the system id of the target.
+	SystemId byte
+
+	// (optional) the component id of the target.
+	// It defaults to 1 (MAV_COMP_ID_AUTOPILOT1).
+	ComponentId byte
+
+	// (optional) the time to wait for each response of the target.
+	// It defaults to 1 second.
+	Timeout time.Duration
+
+	// (optional) the number of times a request is sent again when the target
+	// does not respond. It defaults to 3.
+	Retries int
+}
+
+// FtpClient implements the client side of the file transfer protocol (FTP),
+// that allows to access the file system of a target.
+// Methods must not be called by the routine that reads Events(), since incoming
+// frames are not processed until events are consumed.
+type FtpClient struct {
+	conf  FtpClientConf
+	mutex sync.Mutex
+	seq   uint16
+}
+
+// NewFtpClient allocates a FtpClient. See FtpClientConf for the options.
+func NewFtpClient(conf FtpClientConf) (*FtpClient, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if conf.SystemId < 1 {
+		return nil, fmt.Errorf("SystemId must be >= 1")
+	}
+	if conf.ComponentId == 0 {
+		conf.ComponentId = 1
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 1 * time.Second
+	}
+	if conf.Retries == 0 {
+		conf.Retries = 3
+	}
+
+	if dialectHasMessage(conf.Node.conf.D, 110, 84) == false { // FILE_TRANSFER_PROTOCOL
+		return nil, fmt.Errorf("the dialect does not support the file transfer protocol")
+	}
+
+	return &FtpClient{
+		conf: conf,
+	}, nil
+}
+
+// listen returns a listener of the responses of the target, decoded.
+func (c *FtpClient) listen(match func(*ftpPayload) bool) *frameListener {
+	return c.conf.Node.addFrameListener(func(evt *EventFrame) bool {
+		if evt.SystemId() != c.conf.SystemId || evt.ComponentId() != c.conf.ComponentId ||
+			evt.Message().GetId() != 110 {
+			return false
+		}
+
+		ts, _ := messageFieldUint(evt.Message(), "target_system")
+		if byte(ts) != c.conf.Node.conf.OutSystemId {
+			return false
+		}
+
+		p, ok := ftpPayloadFromMessage(evt.Message())
+		return ok && match(p)
+	})
+}
+
+func ftpPayloadFromMessage(msg Message) (*ftpPayload, bool) {
+	buf, ok := messageFieldBytes(msg, "payload")
+	if !ok {
+		return nil, false
+	}
+	p := &ftpPayload{}
+	if p.decode(buf) != nil {
+		return nil, false
+	}
+	return p, true
+}
+
+func (c *FtpClient) newMessage(p *ftpPayload) (Message, error) {
+	msg := dialectNewMessage(c.conf.Node.conf.D, 110)
+	err := messageSetFields(msg, map[string]interface{}{
+		"target_network":   uint8(0),
+		"target_system":    c.conf.SystemId,
+		"target_component": c.conf.ComponentId,
+		"payload":          p.encode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// do sends a request and waits for the corresponding ACK or NAK. In case of
+// timeout, the request is sent again with the same sequence number, in order
+// to allow the target to detect duplicates.
+func (c *FtpClient) do(ctx context.Context, req *ftpPayload) (*ftpPayload, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seq++
+	req.seq = c.seq
+
+	msg, err := c.newMessage(req)
+	if err != nil {
+		return nil, err
+	}
+
+	l := c.listen(func(p *ftpPayload) bool {
+		return p.seq == req.seq+1 && p.reqOpcode == req.opcode &&
+			(p.opcode == _FTP_OP_ACK || p.opcode == _FTP_OP_NAK)
+	})
+	defer c.conf.Node.removeFrameListener(l)
+
+	evt, err := c.conf.Node.request(ctx, l, msg, c.conf.Timeout, c.conf.Retries,
+		func(evt *EventFrame) (bool, error) {
+			return true, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	c.seq++
+	res, _ := ftpPayloadFromMessage(evt.Message())
+	return res, res.err()
+}
+
+// ListDirectory returns the entries of a remote directory.
+func (c *FtpClient) ListDirectory(ctx context.Context, path string) ([]*FtpEntry, error) {
+	data, err := ftpPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*FtpEntry
+	offset := uint32(0)
+
+	for {
+		res, err := c.do(ctx, &ftpPayload{
+			opcode: _FTP_OP_LIST_DIRECTORY,
+			offset: offset,
+			data:   data,
+		})
+		if err != nil {
+			if isFtpEOF(err) {
+				return entries, nil
+			}
+			return nil, err
+		}
+
+		parts := strings.Split(strings.TrimRight(string(res.data), "\x00"), "\x00")
+		if len(parts) == 0 || parts[0] == "" {
+			return entries, nil
+		}
+
+		// every part, including skipped ones, counts as an entry
+		offset += uint32(len(parts))
+
+		for _, part := range parts {
+			if len(part) < 2 {
+				continue
+			}
+
+			switch part[0] {
+			case 'D':
+				entries = append(entries, &FtpEntry{
+					Name:  part[1:],
+					IsDir: true,
+				})
+
+			case 'F':
+				e := &FtpEntry{Name: part[1:]}
+				if i := strings.LastIndexByte(e.Name, '\t'); i >= 0 {
+					size, _ := strconv.ParseUint(e.Name[i+1:], 10, 32)
+					e.Size = uint32(size)
+					e.Name = e.Name[:i]
+				}
+				entries = append(entries, e)
+			}
+		}
+	}
+}
+
+func (c *FtpClient) openSession(ctx context.Context, opcode uint8, path string) (*FtpFile, error) {
+	data, err := ftpPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, &ftpPayload{
+		opcode: opcode,
+		data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FtpFile{
+		c:       c,
+		ctx:     ctx,
+		session: res.session,
+	}
+	if opcode == _FTP_OP_OPEN_FILE_RO && len(res.data) >= 4 {
+		f.size = binary.LittleEndian.Uint32(res.data)
+	}
+	return f, nil
+}
+
+// Open opens a remote file for reading.
+// The context is used by all the operations performed on the file.
+func (c *FtpClient) Open(ctx context.Context, path string) (*FtpFile, error) {
+	return c.openSession(ctx, _FTP_OP_OPEN_FILE_RO, path)
+}
+
+// Create creates a remote file and opens it for writing.
+// The context is used by all the operations performed on the file.
+func (c *FtpClient) Create(ctx context.Context, path string) (*FtpFile, error) {
+	return c.openSession(ctx, _FTP_OP_CREATE_FILE, path)
+}
+
+// OpenWrite opens an existing remote file for writing.
+// The context is used by all the operations performed on the file.
+func (c *FtpClient) OpenWrite(ctx context.Context, path string) (*FtpFile, error) {
+	return c.openSession(ctx, _FTP_OP_OPEN_FILE_WO, path)
+}
+
+func (c *FtpClient) pathRequest(ctx context.Context, opcode uint8, path string, offset uint32) error {
+	data, err := ftpPath(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, &ftpPayload{
+		opcode: opcode,
+		offset: offset,
+		data:   data,
+	})
+	return err
+}
+
+// Remove removes a remote file.
+func (c *FtpClient) Remove(ctx context.Context, path string) error {
+	return c.pathRequest(ctx, _FTP_OP_REMOVE_FILE, path, 0)
+}
+
+// CreateDirectory creates a remote directory.
+func (c *FtpClient) CreateDirectory(ctx context.Context, path string) error {
+	return c.pathRequest(ctx, _FTP_OP_CREATE_DIRECTORY, path, 0)
+}
+
+// RemoveDirectory removes an empty remote directory.
+func (c *FtpClient) RemoveDirectory(ctx context.Context, path string) error {
+	return c.pathRequest(ctx, _FTP_OP_REMOVE_DIRECTORY, path, 0)
+}
+
+// Truncate changes the size of a remote file.
+func (c *FtpClient) Truncate(ctx context.Context, path string, size uint32) error {
+	return c.pathRequest(ctx, _FTP_OP_TRUNCATE_FILE, path, size)
+}
+
+// Rename renames a remote file or directory.
+func (c *FtpClient) Rename(ctx context.Context, oldPath string, newPath string) error {
+	return c.pathRequest(ctx, _FTP_OP_RENAME, oldPath+"\x00"+newPath, 0)
+}
+
+// ResetSessions closes all the sessions opened on the target.
+func (c *FtpClient) ResetSessions(ctx context.Context) error {
+	_, err := c.do(ctx, &ftpPayload{
+		opcode: _FTP_OP_RESET_SESSIONS,
+	})
+	return err
+}
+
+// CRC32 returns the CRC32 of a remote file, computed by the target.
+func (c *FtpClient) CRC32(ctx context.Context, path string) (uint32, error) {
+	data, err := ftpPath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.do(ctx, &ftpPayload{
+		opcode: _FTP_OP_CALC_FILE_CRC32,
+		data:   data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(res.data) < 4 {
+		return 0, fmt.Errorf("invalid CRC32 response")
+	}
+	return binary.LittleEndian.Uint32(res.data), nil
+}
+
+// ftpDownload is a download in progress. Data is written into the writer in
+// order. Chunks received after a lost one are kept until the lost one is
+// read again, up to _FTP_DOWNLOAD_MAX_PENDING chunks, and the others are
+// discarded and read again later.
+type ftpDownload struct {
+	w       io.Writer
+	size    uint32
+	offset  uint32
+	crc     uint32
+	pending map[uint32][]byte
+}
+
+func (d *ftpDownload) write(data []byte) error {
+	_, err := d.w.Write(data)
+	if err != nil {
+		return err
+	}
+	d.crc = ftpCRC32(d.crc, data)
+	d.offset += uint32(len(data))
+	return nil
+}
+
+// onChunk processes a chunk of the file, starting at the given offset.
+func (d *ftpDownload) onChunk(offset uint32, data []byte) error {
+	// data beyond the size of the file is ignored
+	if offset >= d.size {
+		return nil
+	}
+	if uint32(len(data)) > d.size-offset {
+		data = data[:d.size-offset]
+	}
+
+	if offset > d.offset {
+		if len(d.pending) < _FTP_DOWNLOAD_MAX_PENDING {
+			d.pending[offset] = append([]byte(nil), data...)
+		}
+		return nil
+	}
+
+	if end := offset + uint32(len(data)); end > d.offset {
+		err := d.write(data[d.offset-offset:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.flush()
+}
+
+// flush writes the pending chunks that are not preceded by a gap anymore.
+func (d *ftpDownload) flush() error {
+	for {
+		found := false
+
+		for offset, data := range d.pending {
+			if offset > d.offset {
+				continue
+			}
+
+			delete(d.pending, offset)
+			if end := offset + uint32(len(data)); end > d.offset {
+				err := d.write(data[d.offset-offset:])
+				if err != nil {
+					return err
+				}
+			}
+			found = true
+			break
+		}
+
+		if !found {
+			return nil
+		}
+	}
+}
+
+// gap returns the size of the data that is missing before the first pending
+// chunk.
+func (d *ftpDownload) gap() uint32 {
+	var first uint32
+	found := false
+	for offset := range d.pending {
+		if !found || offset < first {
+			first = offset
+			found = true
+		}
+	}
+	if !found {
+		return 0
+	}
+	return first - d.offset
+}
+
+// burstRead reads a part of a file with burst reads, starting at the offset
+// of the download. It returns true when the target has reached the end of
+// the file.
+func (c *FtpClient) burstRead(ctx context.Context, session uint8, d *ftpDownload) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seq++
+	req := &ftpPayload{
+		seq:     c.seq,
+		session: session,
+		opcode:  _FTP_OP_BURST_READ_FILE,
+		offset:  d.offset,
+	}
+	msg, err := c.newMessage(req)
+	if err != nil {
+		return false, err
+	}
+
+	l := c.listen(func(p *ftpPayload) bool {
+		return p.reqOpcode == _FTP_OP_BURST_READ_FILE && p.session == session
+	})
+	defer c.conf.Node.removeFrameListener(l)
+
+	received := false
+
+	for attempt := 0; attempt <= c.conf.Retries && !received; attempt++ {
+		c.conf.Node.WriteMessageRouted(msg)
+
+		timer := time.NewTimer(c.conf.Timeout)
+
+	burst:
+		for {
+			select {
+			case evt := <-l.frames:
+				res, _ := ftpPayloadFromMessage(evt.Message())
+				received = true
+				c.seq = res.seq
+
+				if err := res.err(); err != nil {
+					timer.Stop()
+					if isFtpEOF(err) {
+						return true, nil
+					}
+					return false, err
+				}
+
+				err := d.onChunk(res.offset, res.data)
+				if err != nil {
+					timer.Stop()
+					return false, err
+				}
+
+				if res.burstComplete != 0 || d.offset >= d.size {
+					timer.Stop()
+					return false, nil
+				}
+
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(c.conf.Timeout)
+
+			case <-timer.C:
+				break burst
+
+			case <-ctx.Done():
+				timer.Stop()
+				return false, ctx.Err()
+			}
+		}
+	}
+
+	if !received {
+		return false, ErrRequestTimeout
+	}
+
+	// the burst was interrupted, it is resumed by the caller
+	return false, nil
+}
+
+// Download reads a remote file with burst reads and writes it into w, in
+// order and without keeping the whole file in memory.
+// Chunks lost during the transfer are requested again, and the content
+// is verified with the CRC32 computed by the target. In case of error,
+// the data already written into w must be discarded.
+func (c *FtpClient) Download(ctx context.Context, path string, w io.Writer) error {
+	f, err := c.Open(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := &ftpDownload{
+		w:       w,
+		size:    f.size,
+		pending: make(map[uint32][]byte),
+	}
+
+	for d.offset < d.size {
+		start := d.offset
+		eof, err := c.burstRead(ctx, f.session, d)
+		if err != nil {
+			return err
+		}
+
+		// read again the data lost before the pending chunks
+		if gap := d.gap(); gap > 0 {
+			buf := make([]byte, gap)
+			n, err := f.ReadAt(buf, int64(d.offset))
+			if n > 0 {
+				err2 := d.onChunk(d.offset, buf[:n])
+				if err2 != nil {
+					return err2
+				}
+			}
+			if err == io.EOF {
+				// the file is shorter than expected
+				break
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the file is shorter than expected
+		if eof && d.offset == start {
+			break
+		}
+	}
+
+	crc, err := c.CRC32(ctx, path)
+	if err != nil {
+		return err
+	}
+	if crc != d.crc {
+		return fmt.Errorf("CRC32 mismatch")
+	}
+	return nil
+}
+
+// Upload creates a remote file with the content of r. The content
+// is verified with the CRC32 computed by the target.
+func (c *FtpClient) Upload(ctx context.Context, path string, r io.Reader) error {
+	f, err := c.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	var crc uint32
+	_, err = io.Copy(f, io.TeeReader(r, writerFunc(func(p []byte) (int, error) {
+		crc = ftpCRC32(crc, p)
+		return len(p), nil
+	})))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	remote, err := c.CRC32(ctx, path)
+	if err != nil {
+		return err
+	}
+	if remote != crc {
+		return fmt.Errorf("CRC32 mismatch")
+	}
+	return nil
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// FtpFile is a remote file opened by a FtpClient. It implements io.Reader,
+// io.ReaderAt, io.Writer and io.Closer.
+type FtpFile struct {
+	c       *FtpClient
+	ctx     context.Context
+	session uint8
+	size    uint32
+	offset  uint32
+	closed  bool
+}
+
+// Size returns the size of a file opened with Open().
+func (f *FtpFile) Size() uint32 {
+	return f.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *FtpFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		size := len(p) - n
+		if size > _FTP_DATA_SIZE {
+			size = _FTP_DATA_SIZE
+		}
+
+		// the requested size is carried by the size field of the header
+		res, err := f.c.do(f.ctx, &ftpPayload{
+			session: f.session,
+			opcode:  _FTP_OP_READ_FILE,
+			offset:  uint32(off) + uint32(n),
+			data:    make([]byte, size),
+		})
+		if err != nil {
+			if isFtpEOF(err) {
+				return n, io.EOF
+			}
+			return n, err
+		}
+		if len(res.data) == 0 {
+			return n, io.EOF
+		}
+
+		n += copy(p[n:], res.data)
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (f *FtpFile) Read(p []byte) (int, error) {
+	if len(p) > _FTP_DATA_SIZE {
+		p = p[:_FTP_DATA_SIZE]
+	}
+	n, err := f.ReadAt(p, int64(f.offset))
+	f.offset += uint32(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Write implements io.Writer.
+func (f *FtpFile) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > _FTP_DATA_SIZE {
+			chunk = chunk[:_FTP_DATA_SIZE]
+		}
+
+		_, err := f.c.do(f.ctx, &ftpPayload{
+			session: f.session,
+			opcode:  _FTP_OP_WRITE_FILE,
+			offset:  f.offset,
+			data:    chunk,
+		})
+		if err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		f.offset += uint32(len(chunk))
+	}
+	return n, nil
+}
+
+// Close implements io.Closer. It terminates the session of the file.
+func (f *FtpFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	_, err := f.c.do(f.ctx, &ftpPayload{
+		session: f.session,
+		opcode:  _FTP_OP_TERMINATE_SESSION,
+	})
+	return err
+}
+
+var _ io.ReadWriteCloser = (*FtpFile)(nil)
+var _ io.ReaderAt = (*FtpFile)(nil)
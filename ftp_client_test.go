@@ -0,0 +1,277 @@
+package gomavlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFtpCRC32(t *testing.T) {
+	require.Equal(t, uint32(0x2dfd2d88), ftpCRC32(0, []byte("123456789")))
+	require.Equal(t, uint32(0x2dfd2d88), ftpCRC32(ftpCRC32(0, []byte("1234")), []byte("56789")))
+}
+
+// testFtpServer implements a minimal FTP server with a static dialect.
+// It drops the first response to a read and the second chunk of the first
+// burst, in order to test retransmissions and gap filling. The size of the
+// files in announced is increased, in order to test files that are shorter
+// than expected.
+func testFtpServer(node *Node, files map[string][]byte, announced map[string]int) {
+	sessions := make(map[uint8]string)
+	nextSession := uint8(0)
+	readDropped := false
+	burstDropped := false
+
+	for evt := range node.Events() {
+		e, ok := evt.(*EventFrame)
+		if !ok {
+			continue
+		}
+		msg, ok := e.Message().(*MessageFileTransferProtocol)
+		if !ok {
+			continue
+		}
+
+		req := &ftpPayload{}
+		req.decode(msg.Payload[:])
+
+		reply := func(res *ftpPayload) {
+			res.seq = req.seq + 1
+			res.session = req.session
+			res.reqOpcode = req.opcode
+			if res.opcode == 0 {
+				res.opcode = _FTP_OP_ACK
+			}
+			out := &MessageFileTransferProtocol{
+				TargetSystem:    e.SystemId(),
+				TargetComponent: e.ComponentId(),
+			}
+			copy(out.Payload[:], res.encode())
+			node.WriteMessageTo(e.Channel, out)
+		}
+		nak := func(code uint8) {
+			reply(&ftpPayload{opcode: _FTP_OP_NAK, data: []byte{code}})
+		}
+
+		path := string(req.data)
+
+		switch req.opcode {
+		case _FTP_OP_LIST_DIRECTORY:
+			if req.offset > 0 {
+				nak(_FTP_ERR_EOF)
+				continue
+			}
+			reply(&ftpPayload{data: []byte("Dlogs\x00S\x00Fparams.txt\t12\x00")})
+
+		case _FTP_OP_OPEN_FILE_RO, _FTP_OP_CREATE_FILE:
+			if req.opcode == _FTP_OP_CREATE_FILE {
+				files[path] = nil
+			}
+			content, ok := files[path]
+			if !ok {
+				nak(10)
+				continue
+			}
+			sessions[nextSession] = path
+			size := make([]byte, 4)
+			binary.LittleEndian.PutUint32(size, uint32(len(content)+announced[path]))
+			req.session = nextSession
+			nextSession++
+			reply(&ftpPayload{data: size})
+
+		case _FTP_OP_READ_FILE:
+			if !readDropped {
+				readDropped = true
+				continue
+			}
+			content := files[sessions[req.session]]
+			if int(req.offset) >= len(content) {
+				nak(_FTP_ERR_EOF)
+				continue
+			}
+			end := int(req.offset) + len(req.data)
+			if end > len(content) {
+				end = len(content)
+			}
+			reply(&ftpPayload{offset: req.offset, data: content[req.offset:end]})
+
+		case _FTP_OP_BURST_READ_FILE:
+			content := files[sessions[req.session]]
+			if int(req.offset) >= len(content) {
+				nak(_FTP_ERR_EOF)
+				continue
+			}
+			seq := req.seq
+			for off := int(req.offset); off < len(content); off += _FTP_DATA_SIZE {
+				end := off + _FTP_DATA_SIZE
+				if end > len(content) {
+					end = len(content)
+				}
+				seq++
+				if !burstDropped && off == _FTP_DATA_SIZE {
+					burstDropped = true
+					continue
+				}
+				res := &ftpPayload{
+					seq:       seq,
+					session:   req.session,
+					opcode:    _FTP_OP_ACK,
+					reqOpcode: req.opcode,
+					offset:    uint32(off),
+					data:      content[off:end],
+				}
+				if end == len(content) {
+					res.burstComplete = 1
+				}
+				out := &MessageFileTransferProtocol{TargetSystem: e.SystemId()}
+				copy(out.Payload[:], res.encode())
+				node.WriteMessageTo(e.Channel, out)
+			}
+
+		case _FTP_OP_WRITE_FILE:
+			p := sessions[req.session]
+			content := files[p]
+			for len(content) < int(req.offset)+len(req.data) {
+				content = append(content, 0)
+			}
+			copy(content[req.offset:], req.data)
+			files[p] = content
+			reply(&ftpPayload{})
+
+		case _FTP_OP_TERMINATE_SESSION:
+			delete(sessions, req.session)
+			reply(&ftpPayload{})
+
+		case _FTP_OP_CALC_FILE_CRC32:
+			content, ok := files[path]
+			if !ok {
+				nak(10)
+				continue
+			}
+			crc := make([]byte, 4)
+			binary.LittleEndian.PutUint32(crc, ftpCRC32(0, content))
+			reply(&ftpPayload{data: crc})
+
+		case _FTP_OP_REMOVE_FILE:
+			if _, ok := files[path]; !ok {
+				nak(10)
+				continue
+			}
+			delete(files, path)
+			reply(&ftpPayload{})
+
+		default:
+			nak(7)
+		}
+	}
+}
+
+func TestFtpClient(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageFileTransferProtocol{}}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+
+			// the log is larger than the chunks that can be kept in memory
+			// while a lost one is read again
+			log := make([]byte, (_FTP_DOWNLOAD_MAX_PENDING+10)*_FTP_DATA_SIZE+100)
+			for i := range log {
+				log[i] = byte(i)
+			}
+			files := map[string][]byte{
+				"/logs/1.bin": log,
+				"/logs/2.bin": log[:1000],
+			}
+			go testFtpServer(vehicle, files, map[string]int{
+				"/logs/2.bin": 500,
+			})
+
+			gcs, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			go func() {
+				for range gcs.Events() {
+				}
+			}()
+
+			client, err := NewFtpClient(FtpClientConf{
+				Node:     gcs,
+				SystemId: 1,
+				Timeout:  100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			entries, err := client.ListDirectory(ctx, "/")
+			require.NoError(t, err)
+			require.Equal(t, []*FtpEntry{
+				{Name: "logs", IsDir: true},
+				{Name: "params.txt", Size: 12},
+			}, entries)
+
+			f, err := client.Open(ctx, "/logs/1.bin")
+			require.NoError(t, err)
+			require.Equal(t, uint32(len(log)), f.Size())
+			byts, err := ioutil.ReadAll(f)
+			require.NoError(t, err)
+			require.Equal(t, log, byts)
+			require.NoError(t, f.Close())
+
+			var buf bytes.Buffer
+			err = client.Download(ctx, "/logs/1.bin", &buf)
+			require.NoError(t, err)
+			require.Equal(t, log, buf.Bytes())
+
+			buf.Reset()
+			err = client.Download(ctx, "/logs/2.bin", &buf)
+			require.NoError(t, err)
+			require.Equal(t, log[:1000], buf.Bytes())
+
+			config := bytes.Repeat([]byte("PARAM 1\n"), 100)
+			err = client.Upload(ctx, "/config.txt", bytes.NewReader(config))
+			require.NoError(t, err)
+
+			buf.Reset()
+			err = client.Download(ctx, "/config.txt", &buf)
+			require.NoError(t, err)
+			require.Equal(t, config, buf.Bytes())
+
+			require.NoError(t, client.Remove(ctx, "/config.txt"))
+			err = client.Remove(ctx, "/config.txt")
+			require.Equal(t, &FtpError{Code: 10}, err)
+
+			_, err = client.Open(ctx, "/missing")
+			require.Equal(t, "ftp: file not found", err.Error())
+		})
+	}
+}
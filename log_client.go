@@ -0,0 +1,439 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// size of the data carried by LOG_DATA
+	_LOG_CHUNK_SIZE = 90
+	// number of chunks requested at once
+	_LOG_BLOCK_CHUNKS = 128
+)
+
+// LogEntry is a log stored on the target.
+type LogEntry struct {
+	// the log id
+	Id uint16
+	// the time of creation of the log, zero if not available
+	Time time.Time
+	// the log size in bytes
+	Size uint32
+}
+
+// LogClientConf allows to configure a LogClient.
+type LogClientConf struct {
+	// the node used to communicate with the target.
+	Node *Node
+
+	// the system id of the target.
+	SystemId byte
+
+	// (optional) the component id of the target.
+	// It defaults to 1 (MAV_COMP_ID_AUTOPILOT1).
+	ComponentId byte
+
+	// (optional) the time to wait for each response of the target.
+	// It defaults to 1 second.
+	Timeout time.Duration
+
+	// (optional) the number of times a request is sent again when the target
+	// does not respond. It defaults to 3.
+	Retries int
+}
+
+// LogClient implements the client side of the log protocol, that allows to
+// list, download and erase the logs stored on a target.
+// Methods must not be called by the routine that reads Events(), since incoming
+// frames are not processed until events are consumed.
+type LogClient struct {
+	conf LogClientConf
+}
+
+// NewLogClient allocates a LogClient. See LogClientConf for the options.
+func NewLogClient(conf LogClientConf) (*LogClient, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if conf.SystemId < 1 {
+		return nil, fmt.Errorf("SystemId must be >= 1")
+	}
+	if conf.ComponentId == 0 {
+		conf.ComponentId = 1
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 1 * time.Second
+	}
+	if conf.Retries == 0 {
+		conf.Retries = 3
+	}
+
+	if dialectHasMessage(conf.Node.conf.D, 117, 128) == false || // LOG_REQUEST_LIST
+		dialectHasMessage(conf.Node.conf.D, 118, 56) == false || // LOG_ENTRY
+		dialectHasMessage(conf.Node.conf.D, 119, 116) == false || // LOG_REQUEST_DATA
+		dialectHasMessage(conf.Node.conf.D, 120, 134) == false || // LOG_DATA
+		dialectHasMessage(conf.Node.conf.D, 121, 237) == false || // LOG_ERASE
+		dialectHasMessage(conf.Node.conf.D, 122, 203) == false { // LOG_REQUEST_END
+		return nil, fmt.Errorf("the dialect does not support the log protocol")
+	}
+
+	return &LogClient{
+		conf: conf,
+	}, nil
+}
+
+func (c *LogClient) isFromTarget(evt *EventFrame, id uint32) bool {
+	return evt.SystemId() == c.conf.SystemId &&
+		evt.ComponentId() == c.conf.ComponentId &&
+		evt.Message().GetId() == id
+}
+
+func (c *LogClient) newMessage(id uint32, fields map[string]interface{}) (Message, error) {
+	msg := dialectNewMessage(c.conf.Node.conf.D, id)
+	err := messageSetFields(msg, map[string]interface{}{
+		"target_system":    c.conf.SystemId,
+		"target_component": c.conf.ComponentId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = messageSetFields(msg, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// waitSignal waits until cond is true or nothing is signaled for Timeout.
+func (c *LogClient) waitSignal(ctx context.Context, signal chan struct{}, cond func() bool) (bool, error) {
+	timer := time.NewTimer(c.conf.Timeout)
+	defer timer.Stop()
+
+	for {
+		if cond() {
+			return true, nil
+		}
+
+		select {
+		case <-signal:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.conf.Timeout)
+
+		case <-timer.C:
+			return cond(), nil
+
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// List returns the logs stored on the target, sorted by id.
+func (c *LogClient) List(ctx context.Context) ([]*LogEntry, error) {
+	var mutex sync.Mutex
+	entries := make(map[uint16]*LogEntry)
+	count := -1
+	signal := make(chan struct{}, 1)
+
+	h := c.conf.Node.addFrameHandler(func(evt *EventFrame) bool {
+		return c.isFromTarget(evt, 118)
+	}, func(evt *EventFrame) {
+		id, _ := messageFieldUint(evt.Message(), "id")
+		numLogs, _ := messageFieldUint(evt.Message(), "num_logs")
+		timeUtc, _ := messageFieldUint(evt.Message(), "time_utc")
+		size, _ := messageFieldUint(evt.Message(), "size")
+
+		mutex.Lock()
+		count = int(numLogs)
+		// targets without logs send an entry with num_logs = 0
+		if numLogs > 0 {
+			e := &LogEntry{
+				Id:   uint16(id),
+				Size: uint32(size),
+			}
+			if timeUtc != 0 {
+				e.Time = time.Unix(int64(timeUtc), 0)
+			}
+			entries[e.Id] = e
+		}
+		mutex.Unlock()
+
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	})
+	defer c.conf.Node.removeFrameListener(h)
+
+	complete := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return count >= 0 && len(entries) >= count
+	}
+
+	req, err := c.newMessage(117, map[string]interface{}{
+		"start": uint16(0),
+		"end":   uint16(0xFFFF),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ok := false
+	for attempt := 0; attempt <= c.conf.Retries && !ok; attempt++ {
+		c.conf.Node.WriteMessageRouted(req)
+
+		ok, err = c.waitSignal(ctx, signal, complete)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, ErrRequestTimeout
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	ret := make([]*LogEntry, 0, len(entries))
+	for _, e := range entries {
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Id < ret[j].Id
+	})
+	return ret, nil
+}
+
+// Open starts the download of a log. The log is requested in blocks, and
+// chunks lost during the transfer are requested again.
+// The context is used by all the operations performed by the reader.
+// After the download, End() should be called in order to allow the target
+// to resume logging.
+func (c *LogClient) Open(ctx context.Context, entry *LogEntry) *LogReader {
+	r := &LogReader{
+		c:      c,
+		ctx:    ctx,
+		id:     entry.Id,
+		size:   entry.Size,
+		signal: make(chan struct{}, 1),
+	}
+
+	r.handler = c.conf.Node.addFrameHandler(func(evt *EventFrame) bool {
+		return c.isFromTarget(evt, 120)
+	}, r.onLogData)
+
+	return r
+}
+
+// Erase removes all logs from the target.
+func (c *LogClient) Erase() error {
+	msg, err := c.newMessage(121, nil)
+	if err != nil {
+		return err
+	}
+	c.conf.Node.WriteMessageRouted(msg)
+	return nil
+}
+
+// End stops any log transfer and allows the target to resume logging.
+func (c *LogClient) End() error {
+	msg, err := c.newMessage(122, nil)
+	if err != nil {
+		return err
+	}
+	c.conf.Node.WriteMessageRouted(msg)
+	return nil
+}
+
+// LogReader reads a log from the target. It implements io.ReadCloser.
+type LogReader struct {
+	c       *LogClient
+	ctx     context.Context
+	id      uint16
+	size    uint32
+	handler *frameListener
+	signal  chan struct{}
+
+	mutex      sync.Mutex
+	offset     uint32
+	blockStart uint32
+	block      []byte
+	chunks     []bool
+	received   int
+}
+
+func (r *LogReader) onLogData(evt *EventFrame) {
+	id, _ := messageFieldUint(evt.Message(), "id")
+	if uint16(id) != r.id {
+		return
+	}
+	ofs, _ := messageFieldUint(evt.Message(), "ofs")
+	count, _ := messageFieldUint(evt.Message(), "count")
+	data, _ := messageFieldBytes(evt.Message(), "data")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.block == nil || uint32(ofs) < r.blockStart ||
+		(uint32(ofs)-r.blockStart)%_LOG_CHUNK_SIZE != 0 {
+		return
+	}
+
+	i := int((uint32(ofs) - r.blockStart) / _LOG_CHUNK_SIZE)
+	if i >= len(r.chunks) || r.chunks[i] {
+		return
+	}
+
+	if int(count) > len(data) {
+		count = uint64(len(data))
+	}
+	copy(r.block[i*_LOG_CHUNK_SIZE:], data[:count])
+	r.chunks[i] = true
+	r.received++
+
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// missing returns the ranges of chunks of the current block that have not
+// been received yet. It must be called with the mutex held.
+func (r *LogReader) missing() [][2]int {
+	var ret [][2]int
+	for i := 0; i < len(r.chunks); i++ {
+		if r.chunks[i] {
+			continue
+		}
+		j := i
+		for j < len(r.chunks) && !r.chunks[j] {
+			j++
+		}
+		ret = append(ret, [2]int{i, j})
+		i = j
+	}
+	return ret
+}
+
+// fetchBlock downloads the block that starts at the given offset.
+func (r *LogReader) fetchBlock(start uint32) error {
+	size := r.size - start
+	if size > _LOG_CHUNK_SIZE*_LOG_BLOCK_CHUNKS {
+		size = _LOG_CHUNK_SIZE * _LOG_BLOCK_CHUNKS
+	}
+
+	func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.blockStart = start
+		r.block = make([]byte, size)
+		r.chunks = make([]bool, (size+_LOG_CHUNK_SIZE-1)/_LOG_CHUNK_SIZE)
+		r.received = 0
+	}()
+
+	complete := func() bool {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.received == len(r.chunks)
+	}
+
+	attempts := 0
+	for {
+		missing, received := func() ([][2]int, int) {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			return r.missing(), r.received
+		}()
+
+		// only gaps are requested again
+		for _, m := range missing {
+			ofs := start + uint32(m[0]*_LOG_CHUNK_SIZE)
+			end := start + uint32(m[1]*_LOG_CHUNK_SIZE)
+			if end > start+size {
+				end = start + size
+			}
+
+			req, err := r.c.newMessage(119, map[string]interface{}{
+				"id":    r.id,
+				"ofs":   ofs,
+				"count": end - ofs,
+			})
+			if err != nil {
+				return err
+			}
+			r.c.conf.Node.WriteMessageRouted(req)
+		}
+
+		ok, err := r.c.waitSignal(r.ctx, r.signal, complete)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		// give up when the target does not send anything new
+		r.mutex.Lock()
+		progress := r.received > received
+		r.mutex.Unlock()
+
+		if progress {
+			attempts = 0
+		} else {
+			attempts++
+			if attempts > r.c.conf.Retries {
+				return ErrRequestTimeout
+			}
+		}
+	}
+}
+
+// Progress returns the number of bytes read and the size of the log.
+// It can be called while another routine is reading.
+func (r *LogReader) Progress() (uint32, uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.offset, r.size
+}
+
+// Read implements io.Reader.
+func (r *LogReader) Read(p []byte) (int, error) {
+	r.mutex.Lock()
+	offset := r.offset
+	loaded := r.block != nil && offset >= r.blockStart &&
+		offset < r.blockStart+uint32(len(r.block))
+	r.mutex.Unlock()
+
+	if offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if !loaded {
+		err := r.fetchBlock(offset)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := copy(p, r.block[r.offset-r.blockStart:])
+	r.offset += uint32(n)
+	return n, nil
+}
+
+// Close implements io.Closer. It stops receiving data.
+func (r *LogReader) Close() error {
+	r.c.conf.Node.removeFrameListener(r.handler)
+	return nil
+}
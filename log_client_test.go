@@ -0,0 +1,190 @@
+package gomavlib
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testLogVehicle answers to the log protocol with a static dialect.
+// It drops every fifth chunk the first time it is sent, in order to test
+// requests of missing chunks.
+func testLogVehicle(node *Node, logs map[uint16][]byte, ended chan struct{}) {
+	sent := make(map[uint32]bool)
+
+	for evt := range node.Events() {
+		e, ok := evt.(*EventFrame)
+		if !ok {
+			continue
+		}
+
+		switch msg := e.Message().(type) {
+		case *MessageLogRequestList:
+			if len(logs) == 0 {
+				node.WriteMessageTo(e.Channel, &MessageLogEntry{})
+				continue
+			}
+			for id, content := range logs {
+				node.WriteMessageTo(e.Channel, &MessageLogEntry{
+					Id:         id,
+					NumLogs:    uint16(len(logs)),
+					LastLogNum: uint16(len(logs)),
+					TimeUtc:    1600000000,
+					Size:       uint32(len(content)),
+				})
+			}
+
+		case *MessageLogRequestData:
+			content := logs[msg.Id]
+			end := msg.Ofs + msg.Count
+			if end > uint32(len(content)) {
+				end = uint32(len(content))
+			}
+			for ofs := msg.Ofs; ofs < end; ofs += 90 {
+				if (ofs/90)%5 == 0 && !sent[ofs] {
+					sent[ofs] = true
+					continue
+				}
+				out := &MessageLogData{
+					Id:  msg.Id,
+					Ofs: ofs,
+				}
+				out.Count = uint8(copy(out.Data[:], content[ofs:end]))
+				node.WriteMessageTo(e.Channel, out)
+			}
+
+		case *MessageLogErase:
+			for id := range logs {
+				delete(logs, id)
+			}
+
+		case *MessageLogRequestEnd:
+			ended <- struct{}{}
+		}
+	}
+}
+
+func TestLogClient(t *testing.T) {
+	msgs := []Message{
+		&MessageHeartbeat{},
+		&MessageLogRequestList{},
+		&MessageLogEntry{},
+		&MessageLogRequestData{},
+		&MessageLogData{},
+		&MessageLogErase{},
+		&MessageLogRequestEnd{},
+	}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+
+			content := make([]byte, 12345)
+			for i := range content {
+				content[i] = byte(i * 7)
+			}
+			logs := map[uint16][]byte{
+				1: content,
+				2: []byte("short log"),
+			}
+			ended := make(chan struct{})
+			go testLogVehicle(vehicle, logs, ended)
+
+			gcs, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			go func() {
+				for range gcs.Events() {
+				}
+			}()
+
+			client, err := NewLogClient(LogClientConf{
+				Node:     gcs,
+				SystemId: 1,
+				Timeout:  50 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			entries, err := client.List(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []*LogEntry{
+				{Id: 1, Time: time.Unix(1600000000, 0), Size: 12345},
+				{Id: 2, Time: time.Unix(1600000000, 0), Size: 9},
+			}, entries)
+
+			r := client.Open(ctx, entries[0])
+
+			// progress can be polled while reading
+			pollTerminate := make(chan struct{})
+			pollDone := make(chan struct{})
+			go func() {
+				defer close(pollDone)
+				for {
+					select {
+					case <-pollTerminate:
+						return
+					default:
+					}
+					r.Progress()
+					time.Sleep(time.Millisecond)
+				}
+			}()
+
+			byts, err := ioutil.ReadAll(r)
+			close(pollTerminate)
+			<-pollDone
+			require.NoError(t, err)
+			require.Equal(t, content, byts)
+			read, total := r.Progress()
+			require.Equal(t, uint32(12345), read)
+			require.Equal(t, uint32(12345), total)
+			r.Close()
+
+			r = client.Open(ctx, entries[1])
+			byts, err = ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, []byte("short log"), byts)
+			r.Close()
+
+			require.NoError(t, client.End())
+			<-ended
+
+			require.NoError(t, client.Erase())
+			for {
+				entries, err = client.List(ctx)
+				require.NoError(t, err)
+				if len(entries) == 0 {
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package gomavlib
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// cache of the field indexes of static messages, indexed by Mavlink field name
+var messageFieldIndexes sync.Map
+
+func messageStaticFieldIndexes(rt reflect.Type) map[string]int {
+	if cached, ok := messageFieldIndexes.Load(rt); ok {
+		return cached.(map[string]int)
+	}
+
+	indexes := make(map[string]int)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if mavname := field.Tag.Get("mavname"); mavname != "" {
+			indexes[mavname] = i
+		} else {
+			indexes[dialectFieldGoToDef(field.Name)] = i
+		}
+	}
+
+	messageFieldIndexes.Store(rt, indexes)
+	return indexes
+}
+
+// messageField returns the value of a message field, given its Mavlink name
+// (i.e. target_system). It works with both static and dynamic messages.
+func messageField(msg Message, name string) (interface{}, bool) {
+	switch mm := msg.(type) {
+	case *MessageRaw:
+		return nil, false
+
+	case *DynamicMessage:
+		val, ok := mm.Fields[name]
+		return val, ok
+	}
+
+	rv := reflect.ValueOf(msg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	rv = rv.Elem()
+
+	i, ok := messageStaticFieldIndexes(rv.Type())[name]
+	if ok == false {
+		return nil, false
+	}
+	return rv.Field(i).Interface(), true
+}
+
+// messageHasField checks whether a message has a field, given its Mavlink
+// name. Unlike messageField, it works with dynamic messages whose fields have
+// not been set yet.
+func messageHasField(msg Message, name string) bool {
+	if mm, ok := msg.(*DynamicMessage); ok {
+		for _, f := range mm.T.Msg.Fields {
+			if f.OriginalName == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	_, ok := messageField(msg, name)
+	return ok
+}
+
+// messageFieldUint returns the value of an integer or enum field as an uint64.
+func messageFieldUint(msg Message, name string) (uint64, bool) {
+	val, ok := messageField(msg, name)
+	if ok == false {
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	}
+	return 0, false
+}
+
+// messageFieldFloat returns the value of a numeric field as a float64.
+func messageFieldFloat(msg Message, name string) (float64, bool) {
+	val, ok := messageField(msg, name)
+	if ok == false {
+		return 0, false
+	}
+
+	switch tv := val.(type) {
+	case JsonFloat32:
+		return float64(tv.F), true
+
+	case JsonFloat64:
+		return tv.F, true
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+// messageFieldBytes returns the value of an uint8 array field as a byte slice.
+func messageFieldBytes(msg Message, name string) ([]byte, bool) {
+	val, ok := messageField(msg, name)
+	if ok == false {
+		return nil, false
+	}
+
+	if byts, ok := val.([]byte); ok {
+		return byts, true
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Array || rv.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+
+	byts := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(byts), rv)
+	return byts, true
+}
+
+var dynamicFieldTypes = map[string]reflect.Type{
+	"int8":    reflect.TypeOf(int8(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+}
+
+func convertFieldValue(value reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if value.Type().ConvertibleTo(t) == false ||
+		(value.Kind() == reflect.String) != (t.Kind() == reflect.String) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s into %s", value.Type(), t)
+	}
+	return value.Convert(t), nil
+}
+
+// messageSetField sets the value of a message field, given its Mavlink name
+// (i.e. target_system), converting the value into the field type.
+// Arrays can be set with slices. It works with both static and dynamic messages.
+func messageSetField(msg Message, name string, value interface{}) error {
+	rvalue := reflect.ValueOf(value)
+
+	if mm, ok := msg.(*DynamicMessage); ok {
+		for _, f := range mm.T.Msg.Fields {
+			if f.OriginalName != name {
+				continue
+			}
+
+			t, ok := dynamicFieldTypes[f.Type]
+			if ok == false {
+				return fmt.Errorf("unsupported field type: %s", f.Type)
+			}
+
+			if f.ArrayLength != 0 && f.Type != "string" {
+				if rvalue.Kind() != reflect.Slice && rvalue.Kind() != reflect.Array {
+					return fmt.Errorf("field %s is an array", name)
+				}
+
+				// arrays must always be filled entirely in order to be encoded
+				arr := reflect.MakeSlice(reflect.SliceOf(t), f.ArrayLength, f.ArrayLength)
+				for i := 0; i < rvalue.Len() && i < f.ArrayLength; i++ {
+					v, err := convertFieldValue(rvalue.Index(i), t)
+					if err != nil {
+						return err
+					}
+					arr.Index(i).Set(v)
+				}
+				return mm.SetField(name, arr.Interface())
+			}
+
+			v, err := convertFieldValue(rvalue, t)
+			if err != nil {
+				return err
+			}
+			return mm.SetField(name, v.Interface())
+		}
+		return fmt.Errorf("invalid field name: %s", name)
+	}
+
+	rv := reflect.ValueOf(msg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("message cannot be modified")
+	}
+	rv = rv.Elem()
+
+	i, ok := messageStaticFieldIndexes(rv.Type())[name]
+	if ok == false {
+		return fmt.Errorf("invalid field name: %s", name)
+	}
+	target := rv.Field(i)
+
+	if target.Kind() == reflect.Array {
+		if rvalue.Kind() != reflect.Slice && rvalue.Kind() != reflect.Array {
+			return fmt.Errorf("field %s is an array", name)
+		}
+
+		for i := 0; i < target.Len(); i++ {
+			if i >= rvalue.Len() {
+				target.Index(i).Set(reflect.Zero(target.Type().Elem()))
+				continue
+			}
+			v, err := convertFieldValue(rvalue.Index(i), target.Type().Elem())
+			if err != nil {
+				return err
+			}
+			target.Index(i).Set(v)
+		}
+		return nil
+	}
+
+	v, err := convertFieldValue(rvalue, target.Type())
+	if err != nil {
+		return err
+	}
+	target.Set(v)
+	return nil
+}
+
+// messageSetFields sets multiple message fields. See messageSetField.
+func messageSetFields(msg Message, fields map[string]interface{}) error {
+	for name, value := range fields {
+		err := messageSetField(msg, name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
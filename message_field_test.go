@@ -0,0 +1,125 @@
+package gomavlib
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	libgen "github.com/team-rocos/gomavlib/commands/dialgen/libgen"
+)
+
+// testDialectRT allocates a DialectRT that contains the same messages of
+// given static messages.
+func testDialectRT(t *testing.T, msgs ...Message) *DialectRT {
+	def := &libgen.OutDefinition{}
+
+	for _, msg := range msgs {
+		rt := reflect.TypeOf(msg).Elem()
+		outMsg := &libgen.OutMessage{
+			Name:         rt.Name()[len("Message"):],
+			OriginalName: dialectMsgGoToDef(rt.Name()[len("Message"):]),
+			Id:           int(msg.GetId()),
+		}
+
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			outField := &libgen.OutField{
+				Name:         field.Name,
+				OriginalName: dialectFieldGoToDef(field.Name),
+				Index:        i,
+				IsExtension:  field.Tag.Get("mavext") == "true",
+			}
+			if mavname := field.Tag.Get("mavname"); mavname != "" {
+				outField.OriginalName = mavname
+			}
+
+			goType := field.Type
+			if goType.Kind() == reflect.Array {
+				outField.ArrayLength = goType.Len()
+				goType = goType.Elem()
+			}
+
+			if mavenum := field.Tag.Get("mavenum"); mavenum != "" {
+				outField.Type = mavenum
+				outField.IsEnum = true
+			} else {
+				outField.Type = goType.Name()
+			}
+
+			if mavlen := field.Tag.Get("mavlen"); mavlen != "" {
+				outField.ArrayLength, _ = strconv.Atoi(mavlen)
+			}
+
+			outMsg.Fields = append(outMsg.Fields, outField)
+		}
+
+		def.Messages = append(def.Messages, outMsg)
+	}
+
+	d, err := NewDialectRT(3, []*libgen.OutDefinition{def})
+	require.NoError(t, err)
+
+	for _, msg := range msgs {
+		mp, err := newDialectMessage(msg)
+		require.NoError(t, err)
+		require.Equal(t, mp.crcExtra, d.Messages[msg.GetId()].crcExtra)
+	}
+
+	return d
+}
+
+func TestMessageField(t *testing.T) {
+	dCT := MustDialectCT(3, []Message{&MessageCommandLong{}, &MessageParamSet{}, &MessageFileTransferProtocol{}})
+	dRT := testDialectRT(t, &MessageCommandLong{}, &MessageParamSet{}, &MessageFileTransferProtocol{})
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", dCT},
+		{"dynamic", dRT},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			msg := dialectNewMessage(ca.d, 76)
+			err := messageSetFields(msg, map[string]interface{}{
+				"target_system": 3,
+				"command":       uint16(400),
+				"param1":        1.5,
+			})
+			require.NoError(t, err)
+
+			v, ok := messageFieldUint(msg, "target_system")
+			require.Equal(t, true, ok)
+			require.Equal(t, uint64(3), v)
+
+			v, ok = messageFieldUint(msg, "command")
+			require.Equal(t, true, ok)
+			require.Equal(t, uint64(400), v)
+
+			f, ok := messageFieldFloat(msg, "param1")
+			require.Equal(t, true, ok)
+			require.Equal(t, 1.5, f)
+
+			_, ok = messageField(msg, "missing")
+			require.Equal(t, false, ok)
+			require.Error(t, messageSetField(msg, "missing", 1))
+			require.Error(t, messageSetField(msg, "param1", "text"))
+
+			msg = dialectNewMessage(ca.d, 23)
+			require.NoError(t, messageSetField(msg, "param_id", "TEST"))
+			s, _ := messageField(msg, "param_id")
+			require.Equal(t, "TEST", s)
+
+			msg = dialectNewMessage(ca.d, 110)
+			require.NoError(t, messageSetField(msg, "payload", []byte{1, 2, 3}))
+			p, _ := messageField(msg, "payload")
+			require.Equal(t, 251, reflect.ValueOf(p).Len())
+			require.Equal(t, uint8(3), reflect.ValueOf(p).Index(2).Interface())
+
+			b, ok := messageFieldBytes(msg, "payload")
+			require.Equal(t, true, ok)
+			require.Equal(t, append([]byte{1, 2, 3}, make([]byte, 248)...), b)
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// MAV_MISSION_RESULT values
+	_MAV_MISSION_ACCEPTED            = 0
+	_MAV_MISSION_OPERATION_CANCELLED = 15
+)
+
+// MissionType is the type of a mission (MAV_MISSION_TYPE).
+type MissionType uint8
+
+const (
+	// MissionTypeMission contains the items of a flight plan.
+	MissionTypeMission MissionType = 0
+	// MissionTypeFence contains the items of a geofence.
+	MissionTypeFence MissionType = 1
+	// MissionTypeRally contains the rally points.
+	MissionTypeRally MissionType = 2
+	// MissionTypeAll can be used only to clear all missions.
+	MissionTypeAll MissionType = 255
+)
+
+// MissionItem is an item of a mission, in the format of MISSION_ITEM_INT.
+type MissionItem struct {
+	// coordinate system of the item (MAV_FRAME)
+	Frame uint8
+	// action performed by the item (MAV_CMD)
+	Command uint16
+	// 1 if this is the current item
+	Current uint8
+	// 1 to continue to the next item automatically
+	Autocontinue uint8
+	// parameters 1 to 4, see MAV_CMD
+	Param1 float32
+	Param2 float32
+	Param3 float32
+	Param4 float32
+	// local x position or latitude * 10^7
+	X int32
+	// local y position or longitude * 10^7
+	Y int32
+	// z position, global: altitude in meters
+	Z float32
+}
+
+func missionItemFromMessage(msg Message) *MissionItem {
+	i := &MissionItem{}
+	v, _ := messageFieldUint(msg, "frame")
+	i.Frame = uint8(v)
+	v, _ = messageFieldUint(msg, "command")
+	i.Command = uint16(v)
+	v, _ = messageFieldUint(msg, "current")
+	i.Current = uint8(v)
+	v, _ = messageFieldUint(msg, "autocontinue")
+	i.Autocontinue = uint8(v)
+	v, _ = messageFieldUint(msg, "x")
+	i.X = int32(v)
+	v, _ = messageFieldUint(msg, "y")
+	i.Y = int32(v)
+	f, _ := messageFieldFloat(msg, "param1")
+	i.Param1 = float32(f)
+	f, _ = messageFieldFloat(msg, "param2")
+	i.Param2 = float32(f)
+	f, _ = messageFieldFloat(msg, "param3")
+	i.Param3 = float32(f)
+	f, _ = messageFieldFloat(msg, "param4")
+	i.Param4 = float32(f)
+	f, _ = messageFieldFloat(msg, "z")
+	i.Z = float32(f)
+	return i
+}
+
+func (i *MissionItem) fields(seq uint16, missionType MissionType) map[string]interface{} {
+	return map[string]interface{}{
+		"seq":          seq,
+		"frame":        i.Frame,
+		"command":      i.Command,
+		"current":      i.Current,
+		"autocontinue": i.Autocontinue,
+		"param1":       i.Param1,
+		"param2":       i.Param2,
+		"param3":       i.Param3,
+		"param4":       i.Param4,
+		"x":            i.X,
+		"y":            i.Y,
+		"z":            i.Z,
+		"mission_type": missionType,
+	}
+}
+
+// MissionError is the error returned when the target rejects a mission
+// operation with a MISSION_ACK whose result is not MAV_MISSION_ACCEPTED.
+type MissionError struct {
+	// the mission result (MAV_MISSION_RESULT)
+	Result int
+}
+
+// Error implements the error interface.
+func (e *MissionError) Error() string {
+	return fmt.Sprintf("mission operation rejected (result %d)", e.Result)
+}
+
+func dialectHasMissionProtocol(d Dialect) bool {
+	return dialectHasMessage(d, 43, 132) && // MISSION_REQUEST_LIST
+		dialectHasMessage(d, 44, 221) && // MISSION_COUNT
+		dialectHasMessage(d, 45, 232) && // MISSION_CLEAR_ALL
+		dialectHasMessage(d, 47, 153) && // MISSION_ACK
+		dialectHasMessage(d, 51, 196) && // MISSION_REQUEST_INT
+		dialectHasMessage(d, 73, 38) // MISSION_ITEM_INT
+}
+
+// MissionClientConf allows to configure a MissionClient.
+type MissionClientConf struct {
+	// the node used to communicate with the target.
+	Node *Node
+
+	// the system id of the target.
+	SystemId byte
+
+	// (optional) the component id of the target.
+	// It defaults to 1 (MAV_COMP_ID_AUTOPILOT1).
+	ComponentId byte
+
+	// (optional) the time to wait for each response of the target.
+	// It defaults to 1.5 seconds.
+	Timeout time.Duration
+
+	// (optional) the number of times a request is sent again when the target
+	// does not respond. It defaults to 5.
+	Retries int
+}
+
+// MissionClient implements the client side of the mission protocol, that allows
+// to download, upload and clear the missions, geofences and rally points of a
+// target. Operations are performed one at a time.
+// Methods must not be called by the routine that reads Events(), since incoming
+// frames are not processed until events are consumed.
+type MissionClient struct {
+	conf  MissionClientConf
+	mutex sync.Mutex
+}
+
+// NewMissionClient allocates a MissionClient. See MissionClientConf for the options.
+func NewMissionClient(conf MissionClientConf) (*MissionClient, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if conf.SystemId < 1 {
+		return nil, fmt.Errorf("SystemId must be >= 1")
+	}
+	if conf.ComponentId == 0 {
+		conf.ComponentId = 1
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 1500 * time.Millisecond
+	}
+	if conf.Retries == 0 {
+		conf.Retries = 5
+	}
+
+	if dialectHasMissionProtocol(conf.Node.conf.D) == false {
+		return nil, fmt.Errorf("the dialect does not support the mission protocol")
+	}
+
+	return &MissionClient{
+		conf: conf,
+	}, nil
+}
+
+func (c *MissionClient) listen() *frameListener {
+	return c.conf.Node.addFrameListener(func(evt *EventFrame) bool {
+		if evt.SystemId() != c.conf.SystemId || evt.ComponentId() != c.conf.ComponentId {
+			return false
+		}
+
+		switch evt.Message().GetId() {
+		case 40, 44, 47, 51, 73:
+		default:
+			return false
+		}
+
+		// discard responses addressed to other nodes
+		ts, ok := messageFieldUint(evt.Message(), "target_system")
+		return ok && (ts == 0 || byte(ts) == c.conf.Node.conf.OutSystemId)
+	})
+}
+
+func (c *MissionClient) newMessage(id uint32, fields map[string]interface{}) (Message, error) {
+	msg := dialectNewMessage(c.conf.Node.conf.D, id)
+	err := messageSetFields(msg, map[string]interface{}{
+		"target_system":    c.conf.SystemId,
+		"target_component": c.conf.ComponentId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = messageSetFields(msg, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (c *MissionClient) sendAck(result int, missionType MissionType) {
+	msg, err := c.newMessage(47, map[string]interface{}{
+		"type":         result,
+		"mission_type": missionType,
+	})
+	if err != nil {
+		return
+	}
+	c.conf.Node.WriteMessageRouted(msg)
+}
+
+// cancel notifies the target that the ongoing transaction has been aborted.
+func (c *MissionClient) cancel(err error, missionType MissionType) error {
+	if _, ok := err.(*MissionError); !ok {
+		c.sendAck(_MAV_MISSION_OPERATION_CANCELLED, missionType)
+	}
+	return err
+}
+
+func hasMissionType(msg Message, missionType MissionType) bool {
+	// mission_type is an extension, therefore it is zero when
+	// the target uses Mavlink V1
+	mt, _ := messageFieldUint(msg, "mission_type")
+	return missionType == MissionTypeAll || MissionType(mt) == missionType
+}
+
+// ackError returns the error contained in a MISSION_ACK, if any.
+func ackError(msg Message) error {
+	result, _ := messageFieldUint(msg, "type")
+	if result != _MAV_MISSION_ACCEPTED {
+		return &MissionError{int(result)}
+	}
+	return nil
+}
+
+// Download downloads the mission of the given type from the target.
+func (c *MissionClient) Download(ctx context.Context, missionType MissionType) ([]*MissionItem, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	l := c.listen()
+	defer c.conf.Node.removeFrameListener(l)
+
+	req, err := c.newMessage(43, map[string]interface{}{
+		"mission_type": missionType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evt, err := c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+		func(evt *EventFrame) (bool, error) {
+			msg := evt.Message()
+			if hasMissionType(msg, missionType) == false {
+				return false, nil
+			}
+
+			switch msg.GetId() {
+			case 44: // MISSION_COUNT
+				return true, nil
+
+			case 47: // MISSION_ACK
+				return false, ackError(msg)
+			}
+			return false, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := messageFieldUint(evt.Message(), "count")
+	items := make([]*MissionItem, count)
+
+	for seq := uint16(0); seq < uint16(count); seq++ {
+		req, err := c.newMessage(51, map[string]interface{}{
+			"seq":          seq,
+			"mission_type": missionType,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		evt, err := c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+			func(evt *EventFrame) (bool, error) {
+				msg := evt.Message()
+				if hasMissionType(msg, missionType) == false {
+					return false, nil
+				}
+
+				switch msg.GetId() {
+				case 73: // MISSION_ITEM_INT
+					s, _ := messageFieldUint(msg, "seq")
+					return uint16(s) == seq, nil
+
+				case 47: // MISSION_ACK
+					return false, ackError(msg)
+				}
+				return false, nil
+			})
+		if err != nil {
+			return nil, c.cancel(err, missionType)
+		}
+
+		items[seq] = missionItemFromMessage(evt.Message())
+	}
+
+	c.sendAck(_MAV_MISSION_ACCEPTED, missionType)
+
+	return items, nil
+}
+
+// Upload replaces the mission of the given type of the target with the given items.
+func (c *MissionClient) Upload(ctx context.Context, missionType MissionType, items []*MissionItem) error {
+	if len(items) > 0xFFFF {
+		return fmt.Errorf("too many items")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	l := c.listen()
+	defer c.conf.Node.removeFrameListener(l)
+
+	req, err := c.newMessage(44, map[string]interface{}{
+		"count":        uint16(len(items)),
+		"mission_type": missionType,
+	})
+	if err != nil {
+		return err
+	}
+
+	sent := make([]bool, len(items))
+	sentCount := 0
+
+	for {
+		// the target requests the items one by one, and acknowledges
+		// the mission when it has received all of them. In case of timeout,
+		// the last message is sent again.
+		evt, err := c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+			func(evt *EventFrame) (bool, error) {
+				msg := evt.Message()
+				if hasMissionType(msg, missionType) == false {
+					return false, nil
+				}
+
+				switch msg.GetId() {
+				case 40, 51: // MISSION_REQUEST, MISSION_REQUEST_INT
+					seq, _ := messageFieldUint(msg, "seq")
+					if int(seq) >= len(items) {
+						return false, fmt.Errorf("target requested a non-existent item (%d)", seq)
+					}
+					return true, nil
+
+				case 47: // MISSION_ACK
+					return true, ackError(msg)
+				}
+				return false, nil
+			})
+		if err != nil {
+			return c.cancel(err, missionType)
+		}
+
+		msg := evt.Message()
+
+		if msg.GetId() == 47 {
+			if sentCount != len(items) {
+				return fmt.Errorf("target acknowledged the mission before receiving all items")
+			}
+			return nil
+		}
+
+		// items are always sent with MISSION_ITEM_INT, even when requested with
+		// the deprecated MISSION_REQUEST, as allowed by the protocol
+		seq, _ := messageFieldUint(msg, "seq")
+		if sent[seq] == false {
+			sent[seq] = true
+			sentCount++
+		}
+
+		req, err = c.newMessage(73, items[seq].fields(uint16(seq), missionType))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Clear removes the mission of the given type from the target.
+// MissionTypeAll can be used to remove all missions.
+func (c *MissionClient) Clear(ctx context.Context, missionType MissionType) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	l := c.listen()
+	defer c.conf.Node.removeFrameListener(l)
+
+	req, err := c.newMessage(45, map[string]interface{}{
+		"mission_type": missionType,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+		func(evt *EventFrame) (bool, error) {
+			msg := evt.Message()
+			if msg.GetId() != 47 || hasMissionType(msg, missionType) == false {
+				return false, nil
+			}
+			return true, ackError(msg)
+		})
+	return err
+}
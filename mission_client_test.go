@@ -0,0 +1,184 @@
+package gomavlib
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testMissionMessages = []Message{
+	&MessageHeartbeat{},
+	&MessageMissionRequest{},
+	&MessageMissionRequestList{},
+	&MessageMissionCount{},
+	&MessageMissionClearAll{},
+	&MessageMissionAck{},
+	&MessageMissionRequestInt{},
+	&MessageMissionItemInt{},
+}
+
+// testMissionVehicle answers to the mission protocol with a static dialect.
+// It ignores the first transmission of each item, in order to test retries.
+func testMissionVehicle(node *Node) {
+	missions := make(map[MAV_MISSION_TYPE][]*MessageMissionItemInt)
+	uploading := make(map[MAV_MISSION_TYPE][]*MessageMissionItemInt)
+	ignored := make(map[uint16]bool)
+
+	for evt := range node.Events() {
+		e, ok := evt.(*EventFrame)
+		if !ok {
+			continue
+		}
+
+		switch msg := e.Message().(type) {
+		case *MessageMissionRequestList:
+			node.WriteMessageTo(e.Channel, &MessageMissionCount{
+				TargetSystem: e.SystemId(),
+				Count:        uint16(len(missions[msg.MissionType])),
+				MissionType:  msg.MissionType,
+			})
+
+		case *MessageMissionRequestInt:
+			node.WriteMessageTo(e.Channel, missions[msg.MissionType][msg.Seq])
+
+		case *MessageMissionCount:
+			uploading[msg.MissionType] = nil
+			node.WriteMessageTo(e.Channel, &MessageMissionRequestInt{
+				TargetSystem: e.SystemId(),
+				MissionType:  msg.MissionType,
+			})
+			missions[msg.MissionType] = make([]*MessageMissionItemInt, msg.Count)
+
+		case *MessageMissionItemInt:
+			if !ignored[msg.Seq] {
+				ignored[msg.Seq] = true
+				continue
+			}
+			if int(msg.Seq) != len(uploading[msg.MissionType]) {
+				continue
+			}
+			msg.TargetSystem = e.SystemId()
+			uploading[msg.MissionType] = append(uploading[msg.MissionType], msg)
+
+			if len(uploading[msg.MissionType]) == len(missions[msg.MissionType]) {
+				missions[msg.MissionType] = uploading[msg.MissionType]
+				node.WriteMessageTo(e.Channel, &MessageMissionAck{
+					TargetSystem: e.SystemId(),
+					Type:         MAV_MISSION_ACCEPTED,
+					MissionType:  msg.MissionType,
+				})
+			} else {
+				node.WriteMessageTo(e.Channel, &MessageMissionRequestInt{
+					TargetSystem: e.SystemId(),
+					Seq:          msg.Seq + 1,
+					MissionType:  msg.MissionType,
+				})
+			}
+
+		case *MessageMissionClearAll:
+			result := MAV_MISSION_ACCEPTED
+			if msg.MissionType == MAV_MISSION_TYPE_RALLY {
+				result = MAV_MISSION_UNSUPPORTED
+			} else {
+				delete(missions, msg.MissionType)
+			}
+			node.WriteMessageTo(e.Channel, &MessageMissionAck{
+				TargetSystem: e.SystemId(),
+				Type:         result,
+				MissionType:  msg.MissionType,
+			})
+		}
+	}
+}
+
+func TestMissionClient(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, testMissionMessages)},
+		{"dynamic", testDialectRT(t, testMissionMessages...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, testMissionMessages),
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+			go testMissionVehicle(vehicle)
+
+			gcs, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			go func() {
+				for range gcs.Events() {
+				}
+			}()
+
+			client, err := NewMissionClient(MissionClientConf{
+				Node:     gcs,
+				SystemId: 1,
+				Timeout:  100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			items, err := client.Download(ctx, MissionTypeMission)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(items))
+
+			mission := []*MissionItem{
+				{Frame: 6, Command: 22, Autocontinue: 1, Param1: 15, Z: 10},
+				{Frame: 6, Command: 16, Autocontinue: 1, X: -353632610, Y: 1491652300, Z: 20},
+				{Frame: 6, Command: 21, Autocontinue: 1, X: -353632620, Y: 1491652310},
+			}
+			err = client.Upload(ctx, MissionTypeMission, mission)
+			require.NoError(t, err)
+
+			fence := []*MissionItem{
+				{Frame: 5, Command: 5003, Param1: 300},
+			}
+			err = client.Upload(ctx, MissionTypeFence, fence)
+			require.NoError(t, err)
+
+			items, err = client.Download(ctx, MissionTypeMission)
+			require.NoError(t, err)
+			require.Equal(t, mission, items)
+
+			items, err = client.Download(ctx, MissionTypeFence)
+			require.NoError(t, err)
+			require.Equal(t, fence, items)
+
+			err = client.Clear(ctx, MissionTypeMission)
+			require.NoError(t, err)
+
+			items, err = client.Download(ctx, MissionTypeMission)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(items))
+
+			err = client.Clear(ctx, MissionTypeRally)
+			require.Equal(t, &MissionError{int(MAV_MISSION_UNSUPPORTED)}, err)
+
+			cctx, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = client.Download(cctx, MissionTypeFence)
+			require.Equal(t, context.Canceled, err)
+		})
+	}
+}
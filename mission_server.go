@@ -0,0 +1,671 @@
+package gomavlib
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// MAV_MISSION_RESULT values
+	_MAV_MISSION_ERROR            = 1
+	_MAV_MISSION_UNSUPPORTED      = 3
+	_MAV_MISSION_INVALID_SEQUENCE = 13
+	_MAV_MISSION_DENIED           = 14
+)
+
+// MissionStore is the interface implemented by the objects that store the
+// missions of a MissionServer.
+type MissionStore interface {
+	// Load returns the mission of the given type.
+	Load(missionType MissionType) ([]*MissionItem, error)
+	// Save replaces the mission of the given type.
+	Save(missionType MissionType, items []*MissionItem) error
+}
+
+// MissionStoreMemory is a MissionStore that keeps missions in memory.
+type MissionStoreMemory struct {
+	mutex    sync.Mutex
+	missions map[MissionType][]*MissionItem
+}
+
+// Load implements MissionStore.
+func (s *MissionStoreMemory) Load(missionType MissionType) ([]*MissionItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.missions[missionType], nil
+}
+
+// Save implements MissionStore.
+func (s *MissionStoreMemory) Save(missionType MissionType, items []*MissionItem) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.missions == nil {
+		s.missions = make(map[MissionType][]*MissionItem)
+	}
+	s.missions[missionType] = items
+	return nil
+}
+
+// MissionServerConf allows to configure a MissionServer.
+type MissionServerConf struct {
+	// the node used to communicate with the clients.
+	Node *Node
+
+	// (optional) the store that contains the missions.
+	// It defaults to a MissionStoreMemory.
+	Store MissionStore
+
+	// (optional) the time to wait for each item during an upload.
+	// It defaults to 1.5 seconds.
+	Timeout time.Duration
+
+	// (optional) the number of times an item is requested again when the
+	// client does not send it. It defaults to 5.
+	Retries int
+}
+
+type missionPartner struct {
+	SystemId    byte
+	ComponentId byte
+	MissionType MissionType
+}
+
+// missionUpload is an upload in progress.
+type missionUpload struct {
+	partner  missionPartner
+	channel  *Channel
+	count    int
+	items    []*MissionItem
+	attempts int
+	timer    *time.Timer
+	timerGen int
+	// the client sends MISSION_ITEM instead of MISSION_ITEM_INT
+	float bool
+}
+
+// missionItemScale returns the factor between the x and y coordinates of
+// MISSION_ITEM_INT and the ones of MISSION_ITEM, that depends on the frame.
+func missionItemScale(frame uint8) float64 {
+	switch frame {
+	case 0, 3, 5, 6, 10, 11: // MAV_FRAME_GLOBAL*
+		return 1e7
+	case 2: // MAV_FRAME_MISSION
+		return 1
+	}
+	return 1e4
+}
+
+// missionItemFromFloatMessage converts a MISSION_ITEM into a MissionItem.
+func missionItemFromFloatMessage(msg Message) *MissionItem {
+	i := missionItemFromMessage(msg)
+	scale := missionItemScale(i.Frame)
+	f, _ := messageFieldFloat(msg, "x")
+	i.X = int32(math.Round(f * scale))
+	f, _ = messageFieldFloat(msg, "y")
+	i.Y = int32(math.Round(f * scale))
+	return i
+}
+
+// floatFields returns the fields of the MISSION_ITEM that corresponds to the
+// item.
+func (i *MissionItem) floatFields(seq uint16, missionType MissionType) map[string]interface{} {
+	ret := i.fields(seq, missionType)
+	scale := missionItemScale(i.Frame)
+	ret["x"] = float32(float64(i.X) / scale)
+	ret["y"] = float32(float64(i.Y) / scale)
+	return ret
+}
+
+// MissionServer implements the server side of the mission protocol. It accepts
+// the uploads and serves the downloads of missions, geofences and rally points
+// on behalf of the node, and answers to the requests addressed to the node's
+// system and component. The mission stored is replaced only when an upload
+// is completed.
+// When a client uploads or clears a mission, an EventMissionChange is emitted.
+// When a client changes the current item, an EventMissionSetCurrent is emitted.
+// The server must be closed before the node.
+type MissionServer struct {
+	conf    MissionServerConf
+	handler *frameListener
+
+	mutex     sync.Mutex
+	upload    *missionUpload
+	downloads map[missionPartner][]*MissionItem
+	current   uint16
+	closed    bool
+
+	// upload timers that have been started and not stopped
+	timers sync.WaitGroup
+}
+
+// NewMissionServer allocates a MissionServer. See MissionServerConf for the options.
+func NewMissionServer(conf MissionServerConf) (*MissionServer, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if conf.Store == nil {
+		conf.Store = &MissionStoreMemory{}
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 1500 * time.Millisecond
+	}
+	if conf.Retries == 0 {
+		conf.Retries = 5
+	}
+
+	if dialectHasMissionProtocol(conf.Node.conf.D) == false {
+		return nil, fmt.Errorf("the dialect does not support the mission protocol")
+	}
+
+	s := &MissionServer{
+		conf:      conf,
+		downloads: make(map[missionPartner][]*MissionItem),
+	}
+
+	s.handler = conf.Node.addFrameHandler(s.isRequest, s.onRequest)
+
+	return s, nil
+}
+
+// Close stops serving missions and aborts any upload in progress.
+func (s *MissionServer) Close() {
+	s.conf.Node.removeFrameListener(s.handler)
+
+	func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.closed = true
+		if s.upload != nil {
+			s.stopTimer(s.upload)
+			s.upload = nil
+		}
+	}()
+
+	// wait for timers that are already running
+	s.timers.Wait()
+}
+
+func (s *MissionServer) isRequest(evt *EventFrame) bool {
+	switch evt.Message().GetId() {
+	case 39, 40, 41, 43, 44, 45, 47, 51, 73:
+	default:
+		return false
+	}
+
+	ts, _ := messageFieldUint(evt.Message(), "target_system")
+	tc, _ := messageFieldUint(evt.Message(), "target_component")
+	return byte(ts) == s.conf.Node.conf.OutSystemId &&
+		(tc == 0 || byte(tc) == s.conf.Node.conf.OutComponentId)
+}
+
+func (s *MissionServer) newMessage(id uint32, partner missionPartner, fields map[string]interface{}) (Message, error) {
+	msg := dialectNewMessage(s.conf.Node.conf.D, id)
+	err := messageSetFields(msg, map[string]interface{}{
+		"target_system":    partner.SystemId,
+		"target_component": partner.ComponentId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// mission_type is an extension, that is missing in older dialects
+	if messageHasField(msg, "mission_type") {
+		err = messageSetField(msg, "mission_type", partner.MissionType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range fields {
+		if name == "mission_type" {
+			continue
+		}
+		err = messageSetField(msg, name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+func (s *MissionServer) sendAck(ch *Channel, partner missionPartner, result int) {
+	msg, err := s.newMessage(47, partner, map[string]interface{}{
+		"type": result,
+	})
+	if err != nil {
+		return
+	}
+	s.conf.Node.WriteMessageTo(ch, msg)
+}
+
+func (s *MissionServer) onRequest(evt *EventFrame) {
+	msg := evt.Message()
+	mt, _ := messageFieldUint(msg, "mission_type")
+	partner := missionPartner{evt.SystemId(), evt.ComponentId(), MissionType(mt)}
+
+	switch msg.GetId() {
+	case 43: // MISSION_REQUEST_LIST
+		s.onRequestList(evt, partner)
+
+	case 40, 51: // MISSION_REQUEST, MISSION_REQUEST_INT
+		seq, _ := messageFieldUint(msg, "seq")
+		s.onRequestItem(evt, partner, uint16(seq), msg.GetId() == 40)
+
+	case 47: // MISSION_ACK
+		s.onAck(partner)
+
+	case 44: // MISSION_COUNT
+		count, _ := messageFieldUint(msg, "count")
+		s.onCount(evt, partner, int(count))
+
+	case 73: // MISSION_ITEM_INT
+		s.onItem(evt, partner, missionItemFromMessage(msg), false)
+
+	case 39: // MISSION_ITEM
+		s.onItem(evt, partner, missionItemFromFloatMessage(msg), true)
+
+	case 45: // MISSION_CLEAR_ALL
+		s.onClearAll(evt, partner)
+
+	case 41: // MISSION_SET_CURRENT
+		seq, _ := messageFieldUint(msg, "seq")
+		s.onSetCurrent(evt, uint16(seq))
+	}
+}
+
+func (s *MissionServer) onRequestList(evt *EventFrame, partner missionPartner) {
+	if partner.MissionType > MissionTypeRally {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_UNSUPPORTED)
+		return
+	}
+
+	items, err := s.conf.Store.Load(partner.MissionType)
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+
+	// items are served from a snapshot, in order not to be affected
+	// by uploads performed during the download
+	func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.downloads[partner] = items
+	}()
+
+	msg, err := s.newMessage(44, partner, map[string]interface{}{
+		"count": uint16(len(items)),
+	})
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+	s.conf.Node.WriteMessageTo(evt.Channel, msg)
+}
+
+// onRequestItem answers to MISSION_REQUEST with MISSION_ITEM and to
+// MISSION_REQUEST_INT with MISSION_ITEM_INT.
+func (s *MissionServer) onRequestItem(evt *EventFrame, partner missionPartner, seq uint16, float bool) {
+	items, ok := func() ([]*MissionItem, bool) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		items, ok := s.downloads[partner]
+		return items, ok
+	}()
+
+	var err error
+	if !ok {
+		items, err = s.conf.Store.Load(partner.MissionType)
+		if err != nil {
+			s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+			return
+		}
+	}
+
+	if int(seq) >= len(items) {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_INVALID_SEQUENCE)
+		return
+	}
+
+	var msg Message
+	if float && dialectHasMessage(s.conf.Node.conf.D, 39, 254) { // MISSION_ITEM
+		msg, err = s.newMessage(39, partner, items[seq].floatFields(seq, partner.MissionType))
+	} else {
+		msg, err = s.newMessage(73, partner, items[seq].fields(seq, partner.MissionType))
+	}
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+	s.conf.Node.WriteMessageTo(evt.Channel, msg)
+}
+
+func (s *MissionServer) onAck(partner missionPartner) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the download is completed
+	delete(s.downloads, partner)
+
+	// the client canceled the upload
+	if s.upload != nil && s.upload.partner == partner {
+		s.stopTimer(s.upload)
+		s.upload = nil
+	}
+}
+
+// stopTimer stops the timer of an upload.
+// It must be called with the mutex held.
+func (s *MissionServer) stopTimer(u *missionUpload) {
+	if u.timer != nil && u.timer.Stop() {
+		s.timers.Done()
+	}
+	u.timer = nil
+}
+
+// requestNext restarts the timer of an upload and returns the request of the
+// next item, that must be written after releasing the mutex, in order not to
+// block other requests while the node is busy. In case of errors, the timer
+// is stopped and the upload must be discarded.
+// It must be called with the mutex held.
+func (s *MissionServer) requestNext(u *missionUpload) (Message, error) {
+	s.stopTimer(u)
+
+	// clients that send MISSION_ITEM are asked for items with MISSION_REQUEST
+	id := uint32(51)
+	if u.float && dialectHasMessage(s.conf.Node.conf.D, 40, 230) {
+		id = 40
+	}
+
+	req, err := s.newMessage(id, u.partner, map[string]interface{}{
+		"seq": uint16(len(u.items)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.timers.Add(1)
+	u.timerGen++
+	gen := u.timerGen
+	u.timer = time.AfterFunc(s.conf.Timeout, func() {
+		defer s.timers.Done()
+		s.onUploadTimeout(u, gen)
+	})
+
+	return req, nil
+}
+
+func (s *MissionServer) onUploadTimeout(u *missionUpload, gen int) {
+	res, canceled := func() (Message, bool) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		// the upload has been completed, aborted or restarted
+		if s.upload != u || u.timerGen != gen {
+			return nil, false
+		}
+
+		u.attempts++
+		if u.attempts > s.conf.Retries {
+			// the upload is aborted and the current mission is kept
+			s.upload = nil
+			return nil, true
+		}
+
+		req, err := s.requestNext(u)
+		if err != nil {
+			s.upload = nil
+			return nil, true
+		}
+		return req, false
+	}()
+
+	if canceled {
+		s.sendAck(u.channel, u.partner, _MAV_MISSION_OPERATION_CANCELLED)
+	} else if res != nil {
+		s.conf.Node.WriteMessageTo(u.channel, res)
+	}
+}
+
+func (s *MissionServer) save(evt *EventFrame, partner missionPartner, items []*MissionItem) {
+	err := s.conf.Store.Save(partner.MissionType, items)
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+
+	if partner.MissionType == MissionTypeMission {
+		s.mutex.Lock()
+		s.current = 0
+		s.mutex.Unlock()
+	}
+
+	s.sendAck(evt.Channel, partner, _MAV_MISSION_ACCEPTED)
+
+	s.conf.Node.emitEvent(&EventMissionChange{
+		Channel:     evt.Channel,
+		SystemId:    evt.SystemId(),
+		ComponentId: evt.ComponentId(),
+		MissionType: partner.MissionType,
+	})
+}
+
+func (s *MissionServer) onCount(evt *EventFrame, partner missionPartner, count int) {
+	if partner.MissionType > MissionTypeRally {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_UNSUPPORTED)
+		return
+	}
+
+	req, denied, err := func() (Message, bool, error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if s.closed {
+			return nil, true, nil
+		}
+
+		if s.upload != nil {
+			// only one upload can be performed at once
+			if s.upload.partner.SystemId != partner.SystemId ||
+				s.upload.partner.ComponentId != partner.ComponentId {
+				return nil, true, nil
+			}
+
+			// the client restarted the upload
+			s.stopTimer(s.upload)
+			s.upload = nil
+		}
+
+		if count > 0 {
+			s.upload = &missionUpload{
+				partner: partner,
+				channel: evt.Channel,
+				count:   count,
+				items:   make([]*MissionItem, 0, count),
+			}
+			req, err := s.requestNext(s.upload)
+			if err != nil {
+				s.upload = nil
+				return nil, false, err
+			}
+			return req, false, nil
+		}
+		return nil, false, nil
+	}()
+
+	if denied {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_DENIED)
+		return
+	}
+
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+
+	if req != nil {
+		s.conf.Node.WriteMessageTo(evt.Channel, req)
+		return
+	}
+
+	s.save(evt, partner, nil)
+}
+
+// onItem handles MISSION_ITEM_INT and MISSION_ITEM, that is sent by clients
+// that do not support MISSION_ITEM_INT and whose coordinates are converted.
+func (s *MissionServer) onItem(evt *EventFrame, partner missionPartner, item *MissionItem, float bool) {
+	seq, _ := messageFieldUint(evt.Message(), "seq")
+
+	req, items, err := func() (Message, []*MissionItem, error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		u := s.upload
+		if u == nil || u.partner != partner {
+			return nil, nil, nil
+		}
+
+		// items are accepted in order. Other items are ignored, and the
+		// expected one is requested again after the timeout.
+		if int(seq) != len(u.items) {
+			return nil, nil, nil
+		}
+
+		u.items = append(u.items, item)
+		u.attempts = 0
+		u.float = float
+
+		if len(u.items) < u.count {
+			req, err := s.requestNext(u)
+			if err != nil {
+				s.upload = nil
+				return nil, nil, err
+			}
+			return req, nil, nil
+		}
+
+		s.stopTimer(u)
+		s.upload = nil
+		return nil, u.items, nil
+	}()
+
+	if err != nil {
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+		return
+	}
+
+	if req != nil {
+		s.conf.Node.WriteMessageTo(evt.Channel, req)
+	}
+
+	if items != nil {
+		s.save(evt, partner, items)
+	}
+}
+
+func (s *MissionServer) onClearAll(evt *EventFrame, partner missionPartner) {
+	types := []MissionType{partner.MissionType}
+	switch {
+	case partner.MissionType == MissionTypeAll:
+		types = []MissionType{MissionTypeMission, MissionTypeFence, MissionTypeRally}
+
+	case partner.MissionType > MissionTypeRally:
+		s.sendAck(evt.Channel, partner, _MAV_MISSION_UNSUPPORTED)
+		return
+	}
+
+	for _, t := range types {
+		err := s.conf.Store.Save(t, nil)
+		if err != nil {
+			s.sendAck(evt.Channel, partner, _MAV_MISSION_ERROR)
+			return
+		}
+	}
+
+	for _, t := range types {
+		if t == MissionTypeMission {
+			s.mutex.Lock()
+			s.current = 0
+			s.mutex.Unlock()
+		}
+	}
+
+	s.sendAck(evt.Channel, partner, _MAV_MISSION_ACCEPTED)
+
+	s.conf.Node.emitEvent(&EventMissionChange{
+		Channel:     evt.Channel,
+		SystemId:    evt.SystemId(),
+		ComponentId: evt.ComponentId(),
+		MissionType: partner.MissionType,
+	})
+}
+
+func (s *MissionServer) onSetCurrent(evt *EventFrame, seq uint16) {
+	// invalid requests are ignored
+	if s.SetCurrent(seq) != nil {
+		return
+	}
+
+	s.conf.Node.emitEvent(&EventMissionSetCurrent{
+		Channel:     evt.Channel,
+		SystemId:    evt.SystemId(),
+		ComponentId: evt.ComponentId(),
+		Seq:         seq,
+	})
+}
+
+// Current returns the sequence number of the current mission item.
+func (s *MissionServer) Current() uint16 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current
+}
+
+// SetCurrent changes the current mission item and notifies all clients
+// with MISSION_CURRENT.
+func (s *MissionServer) SetCurrent(seq uint16) error {
+	if dialectHasMessage(s.conf.Node.conf.D, 42, 28) == false { // MISSION_CURRENT
+		return fmt.Errorf("the dialect does not support MISSION_CURRENT")
+	}
+
+	items, err := s.conf.Store.Load(MissionTypeMission)
+	if err != nil {
+		return err
+	}
+	if int(seq) >= len(items) {
+		return fmt.Errorf("invalid sequence number: %d", seq)
+	}
+
+	s.mutex.Lock()
+	s.current = seq
+	s.mutex.Unlock()
+
+	msg := dialectNewMessage(s.conf.Node.conf.D, 42)
+	err = messageSetField(msg, "seq", seq)
+	if err != nil {
+		return err
+	}
+	s.conf.Node.WriteMessageAll(msg)
+	return nil
+}
+
+// ReportReached notifies all clients that a mission item has been reached,
+// with MISSION_ITEM_REACHED.
+func (s *MissionServer) ReportReached(seq uint16) error {
+	if dialectHasMessage(s.conf.Node.conf.D, 46, 11) == false { // MISSION_ITEM_REACHED
+		return fmt.Errorf("the dialect does not support MISSION_ITEM_REACHED")
+	}
+
+	msg := dialectNewMessage(s.conf.Node.conf.D, 46)
+	err := messageSetField(msg, "seq", seq)
+	if err != nil {
+		return err
+	}
+	s.conf.Node.WriteMessageAll(msg)
+	return nil
+}
@@ -0,0 +1,269 @@
+package gomavlib
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissionServer(t *testing.T) {
+	msgs := append([]Message{
+		&MessageMissionSetCurrent{},
+		&MessageMissionCurrent{},
+		&MessageMissionItemReached{},
+		&MessageMissionItem{},
+	}, testMissionMessages...)
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+			vehicleEvents := make(chan Event, 10)
+			go func() {
+				for evt := range vehicle.Events() {
+					switch evt.(type) {
+					case *EventMissionChange, *EventMissionSetCurrent:
+						vehicleEvents <- evt
+					}
+				}
+			}()
+
+			store := &MissionStoreMemory{}
+			server, err := NewMissionServer(MissionServerConf{
+				Node:    vehicle,
+				Store:   store,
+				Timeout: 50 * time.Millisecond,
+				Retries: 2,
+			})
+			require.NoError(t, err)
+			defer server.Close()
+
+			gcs, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			gcsFrames := make(chan Message, 10)
+			go func() {
+				for evt := range gcs.Events() {
+					if e, ok := evt.(*EventFrame); ok {
+						switch e.Message().(type) {
+						case *MessageMissionCurrent, *MessageMissionItemReached, *MessageMissionAck,
+							*MessageMissionItem, *MessageMissionRequest:
+							gcsFrames <- e.Message()
+						}
+					}
+				}
+			}()
+
+			client, err := NewMissionClient(MissionClientConf{
+				Node:     gcs,
+				SystemId: 1,
+				Timeout:  100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			mission := []*MissionItem{
+				{Frame: 6, Command: 22, Current: 1, Autocontinue: 1, Z: 10},
+				{Frame: 6, Command: 16, Autocontinue: 1, X: -353632610, Y: 1491652300, Z: 20},
+				{Frame: 6, Command: 21, Autocontinue: 1},
+			}
+			require.NoError(t, client.Upload(ctx, MissionTypeMission, mission))
+			<-gcsFrames // MISSION_ACK
+
+			evt := <-vehicleEvents
+			require.Equal(t, MissionTypeMission, evt.(*EventMissionChange).MissionType)
+
+			stored, _ := store.Load(MissionTypeMission)
+			require.Equal(t, mission, stored)
+
+			items, err := client.Download(ctx, MissionTypeMission)
+			require.NoError(t, err)
+			require.Equal(t, mission, items)
+
+			items, err = client.Download(ctx, MissionTypeRally)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(items))
+
+			// an interrupted upload does not replace the mission
+			gcs.WriteMessageAll(&MessageMissionCount{
+				TargetSystem: 1,
+				Count:        2,
+			})
+			for {
+				msg := <-gcsFrames
+				if ack, ok := msg.(*MessageMissionAck); ok {
+					require.Equal(t, MAV_MISSION_OPERATION_CANCELLED, ack.Type)
+					break
+				}
+			}
+			stored, _ = store.Load(MissionTypeMission)
+			require.Equal(t, mission, stored)
+
+			// uploads and downloads with MISSION_ITEM are supported
+			gcs.WriteMessageAll(&MessageMissionCount{
+				TargetSystem: 1,
+				Count:        2,
+			})
+			gcs.WriteMessageAll(&MessageMissionItem{
+				TargetSystem: 1,
+				Seq:          0,
+				Frame:        6,
+				Command:      16,
+				X:            45.5,
+				Y:            -12.25,
+				Z:            20,
+			})
+			require.Equal(t, &MessageMissionRequest{
+				TargetSystem:    255,
+				TargetComponent: 1,
+				Seq:             1,
+			}, <-gcsFrames)
+			gcs.WriteMessageAll(&MessageMissionItem{
+				TargetSystem: 1,
+				Seq:          1,
+				Frame:        1,
+				Command:      16,
+				X:            1.5,
+				Y:            -2.25,
+			})
+			ack := (<-gcsFrames).(*MessageMissionAck)
+			require.Equal(t, MAV_MISSION_ACCEPTED, ack.Type)
+			<-vehicleEvents
+
+			stored, _ = store.Load(MissionTypeMission)
+			require.Equal(t, []*MissionItem{
+				{Frame: 6, Command: 16, X: 455000000, Y: -122500000, Z: 20},
+				{Frame: 1, Command: 16, X: 15000, Y: -22500},
+			}, stored)
+
+			gcs.WriteMessageAll(&MessageMissionRequest{
+				TargetSystem: 1,
+				Seq:          0,
+			})
+			require.Equal(t, &MessageMissionItem{
+				TargetSystem:    255,
+				TargetComponent: 1,
+				Seq:             0,
+				Frame:           6,
+				Command:         16,
+				X:               45.5,
+				Y:               -12.25,
+				Z:               20,
+			}, <-gcsFrames)
+
+			require.NoError(t, client.Upload(ctx, MissionTypeMission, mission))
+			<-gcsFrames // MISSION_ACK
+			<-vehicleEvents
+
+			gcs.WriteMessageAll(&MessageMissionSetCurrent{
+				TargetSystem: 1,
+				Seq:          2,
+			})
+			require.Equal(t, &MessageMissionCurrent{Seq: 2}, <-gcsFrames)
+			evt = <-vehicleEvents
+			require.Equal(t, uint16(2), evt.(*EventMissionSetCurrent).Seq)
+			require.Equal(t, uint16(2), server.Current())
+
+			require.Error(t, server.SetCurrent(3))
+			require.NoError(t, server.ReportReached(2))
+			require.Equal(t, &MessageMissionItemReached{Seq: 2}, <-gcsFrames)
+
+			require.NoError(t, client.Clear(ctx, MissionTypeAll))
+			<-gcsFrames // MISSION_ACK
+			evt = <-vehicleEvents
+			require.Equal(t, MissionTypeAll, evt.(*EventMissionChange).MissionType)
+
+			stored, _ = store.Load(MissionTypeMission)
+			require.Equal(t, 0, len(stored))
+
+			// uploads in progress are aborted by Close()
+			gcs.WriteMessageAll(&MessageMissionCount{
+				TargetSystem: 1,
+				Count:        2,
+			})
+			server.Close()
+			time.Sleep(100 * time.Millisecond)
+			stored, _ = store.Load(MissionTypeMission)
+			require.Equal(t, 0, len(stored))
+		})
+	}
+}
+
+// MISSION_ACK without the mission_type extension
+type MessageMissionAckLegacy struct {
+	TargetSystem    uint8
+	TargetComponent uint8
+	Type            MAV_MISSION_RESULT `mavenum:"uint8"`
+}
+
+func (m *MessageMissionAckLegacy) GetId() uint32 {
+	return 47
+}
+
+func (m *MessageMissionAckLegacy) SetField(field string, value interface{}) error {
+	return SetMessageField(m, field, value)
+}
+
+func TestMissionServerLegacyDialect(t *testing.T) {
+	msgs := []Message{&MessageMissionAckLegacy{}}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			s := &MissionServer{
+				conf: MissionServerConf{
+					Node: &Node{conf: NodeConf{D: ca.d}},
+				},
+			}
+
+			// fields are set in a random order, therefore the message is built
+			// multiple times
+			for i := 0; i < 20; i++ {
+				msg, err := s.newMessage(47, missionPartner{255, 190, MissionTypeFence}, map[string]interface{}{
+					"type": _MAV_MISSION_DENIED,
+				})
+				require.NoError(t, err)
+
+				for name, value := range map[string]uint64{
+					"target_system":    255,
+					"target_component": 190,
+					"type":             _MAV_MISSION_DENIED,
+				} {
+					v, ok := messageFieldUint(msg, name)
+					require.True(t, ok)
+					require.Equal(t, value, v)
+				}
+			}
+		})
+	}
+}
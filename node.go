@@ -57,6 +57,14 @@ const (
 	_NET_WRITE_TIMEOUT    = 10 * time.Second
 )
 
+// ErrWriteQueueFull is returned by TryWriteMessageTo() and TryWriteFrameTo()
+// when the outgoing queue of the channel is full.
+var ErrWriteQueueFull = fmt.Errorf("write queue is full")
+
+// ErrChannelClosed is returned by TryWriteMessageTo() and TryWriteFrameTo()
+// when the channel has been closed.
+var ErrChannelClosed = fmt.Errorf("channel is closed")
+
 type goroutinePool sync.WaitGroup
 
 type goroutinePoolRunnable interface {
@@ -81,16 +89,24 @@ type NodeConf struct {
 	// communicate. Each endpoint contains zero or more channels
 	Endpoints []EndpointConf
 
+	// (optional) groups of redundant endpoints, each used as a single
+	// logical link. See LinkConf for the options.
+	Links []LinkConf
+
 	// (optional) the dialect which contains the messages that will be encoded and decoded.
 	// If not provided, messages are decoded in the MessageRaw struct.
 	D Dialect
 
+	// (optional) the accepted frame version. Frames with a different version
+	// are discarded. If not provided, both versions are accepted.
+	InVersion Version
 	// (optional) the secret key used to validate incoming frames.
 	// Non signed frames are discarded, as well as frames with a version < 2.0.
 	InKey *Key
 
 	// Mavlink version used to encode messages. See Version
-	// for the available options.
+	// for the available options. With VAuto, the version is negotiated
+	// independently by each channel.
 	OutVersion Version
 	// the system id, added to every outgoing frame and used to identify this
 	// node in the network.
@@ -111,29 +127,96 @@ type NodeConf struct {
 	// (optional) the autopilot type advertised by heartbeats.
 	// It defaults to MAV_AUTOPILOT_GENERIC
 	HeartbeatAutopilotType int
+	// (optional) the time after which a remote system that stopped sending
+	// heartbeats is considered lost. It defaults to 10 seconds.
+	HeartbeatTimeout time.Duration
+
+	// (optional) disables the channel returned by Events(), that otherwise must
+	// be read continuously. Events can still be received with Subscribe().
+	EventsDisable bool
+
+	// (optional) the maximum number of messages and frames that can be queued
+	// for writing in each channel. It defaults to 64.
+	WriteQueueSize int
+	// (optional) the policy applied when the outgoing queue of a channel is full.
+	// See WriteQueuePolicy for the available options. It defaults to WriteQueueDropOldest.
+	WriteQueuePolicy WriteQueuePolicy
+	// (optional) the priority of outgoing messages and frames, indexed by
+	// message id. HEARTBEAT, COMMAND_INT, COMMAND_LONG and COMMAND_ACK default
+	// to PriorityHigh, other messages to PriorityNormal.
+	WritePriorities map[uint32]Priority
+
+	// (optional) the period after which the rates of channel statistics are
+	// computed again. It defaults to 1 second.
+	StatsPeriod time.Duration
+	// (optional) periodically emit an EventChannelStats for each channel.
+	StatsEventEnable bool
 
 	// (optional) automatically request streams to detected Ardupilot devices,
 	// that need an explicit request in order to emit telemetry stream.
 	StreamRequestEnable bool
+	// (optional) the method used to request streams. See StreamRequestMode
+	// for the available options. It defaults to StreamRequestDataStream.
+	StreamRequestMode StreamRequestMode
 	// (optional) the requested stream frequency in Hz. It defaults to 4.
 	StreamRequestFrequency int
+	// (optional) the messages requested in StreamRequestMessageInterval mode,
+	// as a map from message id to rate in Hz. A rate of zero disables the message.
+	StreamRequestMessages map[uint32]float64
+
+	// (optional) exchange TIMESYNC messages with other systems, in order to
+	// estimate the offset of their clocks. See RemoteTimeUsec().
+	TimesyncEnable bool
+	// (optional) the period between TIMESYNC requests. It defaults to 1 second.
+	TimesyncPeriod time.Duration
+
+	// (optional) discard frames that have already been received through
+	// another channel, identified by system id, component id, sequence id,
+	// message id and checksum. It is useful when remote systems are reachable
+	// through redundant links.
+	DedupEnable bool
+	// (optional) the time within which a frame received again is considered
+	// a duplicate. It defaults to 500 milliseconds.
+	DedupWindow time.Duration
+
+	// (optional) the time to wait for the acknowledgement of a command sent with
+	// SendCommandLong() or SendCommandInt(). It defaults to 1 second.
+	CommandTimeout time.Duration
+	// (optional) the number of times a command is sent again when it is not
+	// acknowledged. It defaults to 3.
+	CommandRetries int
 }
 
 // Node is a high-level Mavlink encoder and decoder that works with endpoints.
 type Node struct {
-	conf              NodeConf
-	eventsOut         chan Event
-	eventsIn          chan eventIn
-	pool              goroutinePool
-	channelAccepters  map[*channelAccepter]struct{}
-	channels          map[*Channel]struct{}
-	nodeHeartbeat     *nodeHeartbeat
-	nodeStreamRequest *nodeStreamRequest
+	conf               NodeConf
+	eventsOut          chan Event
+	eventsIn           chan eventIn
+	pool               goroutinePool
+	channelAccepters   map[*channelAccepter]struct{}
+	channels           map[*Channel]struct{}
+	nodeHeartbeat      *nodeHeartbeat
+	nodeStreamRequest  *nodeStreamRequest
+	nodeRegistry       *nodeRegistry
+	nodeStats          *nodeStats
+	nodeTimesync       *nodeTimesync
+	nodeDedup          *nodeDedup
+	nodeLinks          *nodeLinks
+	nodeRouter         *nodeRouter
+	nodeCommand        *nodeCommand
+	listenersMutex     sync.Mutex
+	listeners          map[*frameListener]struct{}
+	handlers           map[uint32]map[*frameListener]struct{}
+	componentsMutex    sync.Mutex
+	components         map[byte]*NodeComponent
+	subscriptionsMutex sync.Mutex
+	subscriptions      map[*Subscription]struct{}
+	links              []*Link
 }
 
 // NewNode allocates a Node. See NodeConf for the options.
 func NewNode(conf NodeConf) (*Node, error) {
-	if len(conf.Endpoints) == 0 {
+	if len(conf.Endpoints) == 0 && len(conf.Links) == 0 {
 		return nil, fmt.Errorf("at least one endpoint must be provided")
 	}
 	if conf.HeartbeatPeriod == 0 {
@@ -145,9 +228,51 @@ func NewNode(conf NodeConf) (*Node, error) {
 	if conf.HeartbeatAutopilotType == 0 {
 		conf.HeartbeatAutopilotType = 0 // MAV_AUTOPILOT_GENERIC
 	}
+	if conf.HeartbeatTimeout == 0 {
+		conf.HeartbeatTimeout = 10 * time.Second
+	}
+	if conf.StatsPeriod == 0 {
+		conf.StatsPeriod = 1 * time.Second
+	}
 	if conf.StreamRequestFrequency == 0 {
 		conf.StreamRequestFrequency = 4
 	}
+	if conf.WriteQueueSize == 0 {
+		conf.WriteQueueSize = 64
+	}
+	if conf.TimesyncPeriod == 0 {
+		conf.TimesyncPeriod = 1 * time.Second
+	}
+	if conf.DedupWindow == 0 {
+		conf.DedupWindow = 500 * time.Millisecond
+	}
+
+	linkNames := make(map[string]struct{})
+	for i := range conf.Links {
+		lc := &conf.Links[i]
+		if lc.Name == "" {
+			return nil, fmt.Errorf("link name not provided")
+		}
+		if _, ok := linkNames[lc.Name]; ok {
+			return nil, fmt.Errorf("link name %s is used twice", lc.Name)
+		}
+		linkNames[lc.Name] = struct{}{}
+		if len(lc.Endpoints) == 0 {
+			return nil, fmt.Errorf("link %s has no endpoints", lc.Name)
+		}
+		if lc.Timeout == 0 {
+			lc.Timeout = 3 * time.Second
+		}
+		if lc.MaxLossPercent == 0 {
+			lc.MaxLossPercent = 50
+		}
+	}
+	if conf.CommandTimeout == 0 {
+		conf.CommandTimeout = 1 * time.Second
+	}
+	if conf.CommandRetries == 0 {
+		conf.CommandRetries = 3
+	}
 
 	// check Parser configuration here, since Parser is created dynamically
 	if conf.OutVersion == 0 {
@@ -159,9 +284,16 @@ func NewNode(conf NodeConf) (*Node, error) {
 	if conf.OutComponentId < 1 {
 		conf.OutComponentId = 1
 	}
-	if conf.OutKey != nil && conf.OutVersion != V2 {
+	if conf.OutKey != nil && conf.OutVersion == V1 {
 		return nil, fmt.Errorf("OutKey requires V2 frames")
 	}
+	if conf.InKey != nil && conf.InVersion == V1 {
+		return nil, fmt.Errorf("InKey requires V2 frames")
+	}
+	if conf.StreamRequestEnable && conf.StreamRequestMode == StreamRequestMessageInterval &&
+		len(conf.StreamRequestMessages) == 0 {
+		return nil, fmt.Errorf("StreamRequestMessages must be provided in StreamRequestMessageInterval mode")
+	}
 
 	n := &Node{
 		conf: conf,
@@ -171,6 +303,10 @@ func NewNode(conf NodeConf) (*Node, error) {
 		eventsIn:         make(chan eventIn),
 		channelAccepters: make(map[*channelAccepter]struct{}),
 		channels:         make(map[*Channel]struct{}),
+		listeners:        make(map[*frameListener]struct{}),
+		handlers:         make(map[uint32]map[*frameListener]struct{}),
+		components:       make(map[byte]*NodeComponent),
+		subscriptions:    make(map[*Subscription]struct{}),
 	}
 
 	closeExisting := func() {
@@ -184,39 +320,52 @@ func NewNode(conf NodeConf) (*Node, error) {
 
 	// endpoints
 	for _, tconf := range conf.Endpoints {
-		tp, err := tconf.init()
+		ca, ch, err := n.initEndpoint(tconf, nil, 0)
 		if err != nil {
 			closeExisting()
 			return nil, err
 		}
 
-		switch ttp := tp.(type) {
-		case endpointChannelAccepter:
-			ca, err := newChannelAccepter(n, ttp)
-			if err != nil {
-				closeExisting()
-				return nil, err
-			}
-
+		if ca != nil {
 			n.channelAccepters[ca] = struct{}{}
+		} else {
+			n.channels[ch] = struct{}{}
+		}
+	}
 
-		case endpointChannelSingle:
-			ch, err := newChannel(n, ttp, ttp.Label(), ttp)
+	// links
+	for _, lc := range conf.Links {
+		l := &Link{
+			n:    n,
+			conf: lc,
+		}
+		n.links = append(n.links, l)
+
+		for i, tconf := range lc.Endpoints {
+			ca, ch, err := n.initEndpoint(tconf, l, i)
 			if err != nil {
 				closeExisting()
 				return nil, err
 			}
 
-			n.channels[ch] = struct{}{}
-
-		default:
-			panic(fmt.Errorf("endpoint %T does not implement any interface", tp))
+			if ca != nil {
+				n.channelAccepters[ca] = struct{}{}
+			} else {
+				n.channels[ch] = struct{}{}
+			}
 		}
 	}
 
 	// modules
 	n.nodeHeartbeat = newNodeHeartbeat(n)
 	n.nodeStreamRequest = newNodeStreamRequest(n)
+	n.nodeRegistry = newNodeRegistry(n)
+	n.nodeStats = newNodeStats(n)
+	n.nodeTimesync = newNodeTimesync(n)
+	n.nodeDedup = newNodeDedup(n)
+	n.nodeLinks = newNodeLinks(n, n.links)
+	n.nodeRouter = newNodeRouter(n)
+	n.nodeCommand = newNodeCommand(n)
 
 	if n.nodeHeartbeat != nil {
 		n.pool.Start(n.nodeHeartbeat)
@@ -226,6 +375,24 @@ func NewNode(conf NodeConf) (*Node, error) {
 		n.pool.Start(n.nodeStreamRequest)
 	}
 
+	if n.nodeRegistry != nil {
+		n.pool.Start(n.nodeRegistry)
+	}
+
+	n.pool.Start(n.nodeStats)
+
+	if n.nodeTimesync != nil {
+		n.pool.Start(n.nodeTimesync)
+	}
+
+	if n.nodeDedup != nil {
+		n.pool.Start(n.nodeDedup)
+	}
+
+	if n.nodeLinks != nil {
+		n.pool.Start(n.nodeLinks)
+	}
+
 	for ch := range n.channels {
 		n.pool.Start(ch)
 	}
@@ -239,35 +406,177 @@ func NewNode(conf NodeConf) (*Node, error) {
 	return n, nil
 }
 
+// initEndpoint initializes an endpoint and returns its channel accepter
+// or its single channel.
+func (n *Node) initEndpoint(tconf EndpointConf, link *Link, linkIndex int) (*channelAccepter, *Channel, error) {
+	proto, err := newChannelProtocol(n.conf, tconf)
+	if err != nil {
+		return nil, nil, err
+	}
+	proto.link = link
+	proto.linkIndex = linkIndex
+
+	tp, err := tconf.init()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch ttp := tp.(type) {
+	case endpointChannelAccepter:
+		ca, err := newChannelAccepter(n, ttp, proto)
+		if err != nil {
+			ttp.Close()
+			return nil, nil, err
+		}
+		return ca, nil, nil
+
+	case endpointChannelSingle:
+		ch, err := newChannel(n, ttp, proto, ttp.Label(), ttp)
+		if err != nil {
+			ttp.Close()
+			return nil, nil, err
+		}
+		return nil, ch, nil
+
+	default:
+		panic(fmt.Errorf("endpoint %T does not implement any interface", tp))
+	}
+}
+
 func (n *Node) run() {
 outer:
 	for rawEvt := range n.eventsIn {
 		switch evt := rawEvt.(type) {
 		case *eventInChannelNew:
+			// the endpoint has been removed while the channel was being accepted
+			if n.hasChannelAccepter(evt.ch.Endpoint) == false {
+				evt.ch.rwc.Close()
+				continue
+			}
 			n.channels[evt.ch] = struct{}{}
 			n.pool.Start(evt.ch)
 
 		case *eventInChannelClosed:
+			// the channel has been closed by RemoveEndpoint()
+			if _, ok := n.channels[evt.ch]; ok == false {
+				continue
+			}
 			delete(n.channels, evt.ch)
+			n.nodeRouter.onChannelClose(evt.ch)
 			evt.ch.close()
 
 		case *eventInWriteTo:
+			var pw *pendingWrite
+			if _, ok := n.channels[evt.ch]; ok {
+				what, priority := n.itemPriority(evt.what)
+				pw = pw.enqueue(evt.ch, what, priority)
+			}
+			evt.res <- pw
+
+		case *eventInTryWriteTo:
 			if _, ok := n.channels[evt.ch]; ok == false {
-				return
+				evt.res <- ErrChannelClosed
+				continue
+			}
+			what, priority := n.itemPriority(evt.what)
+			if evt.ch.writeQueue.tryPush(what, priority) == false {
+				evt.res <- ErrWriteQueueFull
+				continue
 			}
-			evt.ch.writeChan <- evt.what
+			evt.res <- nil
 
 		case *eventInWriteAll:
+			var pw *pendingWrite
+			what, priority := n.itemPriority(evt.what)
+			var channels []*Channel
 			for ch := range n.channels {
-				ch.writeChan <- evt.what
+				channels = append(channels, ch)
+			}
+			for _, ch := range n.linkChannels(channels, nil) {
+				pw = pw.enqueue(ch, what, priority)
 			}
+			evt.res <- pw
 
 		case *eventInWriteExcept:
+			var pw *pendingWrite
+			what, priority := n.itemPriority(evt.what)
+			var channels []*Channel
 			for ch := range n.channels {
 				if ch != evt.except {
-					ch.writeChan <- evt.what
+					channels = append(channels, ch)
 				}
 			}
+			for _, ch := range n.linkChannels(channels, evt.except) {
+				pw = pw.enqueue(ch, what, priority)
+			}
+			evt.res <- pw
+
+		case *eventInWriteRouted:
+			var pw *pendingWrite
+			what, priority := n.itemPriority(evt.what)
+			channels := n.nodeRouter.route(itemMessage(what), evt.except)
+			for _, ch := range n.linkChannels(channels, evt.except) {
+				pw = pw.enqueue(ch, what, priority)
+			}
+			evt.res <- pw
+
+		case *eventInAddEndpoint:
+			if evt.ca != nil {
+				n.channelAccepters[evt.ca] = struct{}{}
+				n.pool.Start(evt.ca)
+			} else {
+				n.channels[evt.ch] = struct{}{}
+				n.pool.Start(evt.ch)
+			}
+			evt.res <- nil
+
+		case *eventInRemoveEndpoint:
+			found := false
+
+			for ca := range n.channelAccepters {
+				if Endpoint(ca.eca) == evt.e {
+					delete(n.channelAccepters, ca)
+					ca.close()
+					found = true
+				}
+			}
+
+			var closing []*Channel
+			for ch := range n.channels {
+				if ch.Endpoint == evt.e {
+					delete(n.channels, ch)
+					n.nodeRouter.onChannelClose(ch)
+					closing = append(closing, ch)
+					found = true
+				}
+			}
+
+			if found == false {
+				evt.res <- fmt.Errorf("endpoint not found")
+				continue
+			}
+
+			// channels are closed by another routine, since writing queued frames
+			// to a slow peer would block the node
+			go func(res chan error) {
+				var wg sync.WaitGroup
+				for _, ch := range closing {
+					wg.Add(1)
+					go func(ch *Channel) {
+						defer wg.Done()
+						ch.close()
+					}(ch)
+				}
+				wg.Wait()
+				res <- nil
+			}(evt.res)
+
+		case *eventInChannels:
+			channels := make([]*Channel, 0, len(n.channels))
+			for ch := range n.channels {
+				channels = append(channels, ch)
+			}
+			evt.res <- channels
 
 		case *eventInClose:
 			break outer
@@ -276,7 +585,37 @@ outer:
 
 	// consume events up to close()
 	go func() {
-		for range n.eventsIn {
+		for rawEvt := range n.eventsIn {
+			switch evt := rawEvt.(type) {
+			case *eventInWriteTo:
+				evt.res <- nil
+
+			case *eventInWriteAll:
+				evt.res <- nil
+
+			case *eventInWriteExcept:
+				evt.res <- nil
+
+			case *eventInWriteRouted:
+				evt.res <- nil
+
+			case *eventInTryWriteTo:
+				evt.res <- errorTerminated
+
+			case *eventInChannels:
+				evt.res <- nil
+
+			case *eventInAddEndpoint:
+				if evt.ca != nil {
+					evt.ca.close()
+				} else {
+					evt.ch.rwc.Close()
+				}
+				evt.res <- errorTerminated
+
+			case *eventInRemoveEndpoint:
+				evt.res <- errorTerminated
+			}
 		}
 	}()
 
@@ -288,6 +627,24 @@ outer:
 		n.nodeStreamRequest.close()
 	}
 
+	if n.nodeRegistry != nil {
+		n.nodeRegistry.close()
+	}
+
+	n.nodeStats.close()
+
+	if n.nodeTimesync != nil {
+		n.nodeTimesync.close()
+	}
+
+	if n.nodeDedup != nil {
+		n.nodeDedup.close()
+	}
+
+	if n.nodeLinks != nil {
+		n.nodeLinks.close()
+	}
+
 	for ca := range n.channelAccepters {
 		ca.close()
 	}
@@ -297,6 +654,126 @@ outer:
 	}
 }
 
+// pendingWrite contains an item that did not fit into the queues of some
+// channels with the WriteQueueBlock policy. The item is pushed into these
+// queues by the routine that is writing, in order not to block the node.
+type pendingWrite struct {
+	what     interface{}
+	priority Priority
+	channels []*Channel
+}
+
+// enqueue adds an item to the queue of a channel without waiting, and returns
+// the pending write, that is allocated when the queue is full.
+func (pw *pendingWrite) enqueue(ch *Channel, what interface{}, priority Priority) *pendingWrite {
+	if ch.writeQueue.policy != WriteQueueBlock {
+		ch.writeQueue.push(what, priority)
+		return pw
+	}
+
+	if ch.writeQueue.tryPush(what, priority) {
+		return pw
+	}
+
+	if pw == nil {
+		pw = &pendingWrite{
+			what:     what,
+			priority: priority,
+		}
+	}
+	pw.channels = append(pw.channels, ch)
+	return pw
+}
+
+// complete waits until the item has been pushed into all remaining queues.
+// Queues are filled in parallel, in order not to delay a channel because of
+// another one.
+func (pw *pendingWrite) complete() {
+	if pw == nil {
+		return
+	}
+
+	if len(pw.channels) == 1 {
+		pw.channels[0].writeQueue.push(pw.what, pw.priority)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, ch := range pw.channels {
+		wg.Add(1)
+		go func(ch *Channel) {
+			defer wg.Done()
+			ch.writeQueue.push(pw.what, pw.priority)
+		}(ch)
+	}
+	wg.Wait()
+}
+
+func (n *Node) writeTo(channel *Channel, what interface{}) {
+	res := make(chan *pendingWrite)
+	n.eventsIn <- &eventInWriteTo{channel, what, res}
+	(<-res).complete()
+}
+
+func (n *Node) writeAll(what interface{}) {
+	res := make(chan *pendingWrite)
+	n.eventsIn <- &eventInWriteAll{what, res}
+	(<-res).complete()
+}
+
+func (n *Node) writeExcept(exceptChannel *Channel, what interface{}) {
+	res := make(chan *pendingWrite)
+	n.eventsIn <- &eventInWriteExcept{exceptChannel, what, res}
+	(<-res).complete()
+}
+
+func (n *Node) writeRouted(exceptChannel *Channel, what interface{}) {
+	res := make(chan *pendingWrite)
+	n.eventsIn <- &eventInWriteRouted{exceptChannel, what, res}
+	(<-res).complete()
+}
+
+func (n *Node) hasChannelAccepter(e Endpoint) bool {
+	for ca := range n.channelAccepters {
+		if Endpoint(ca.eca) == e {
+			return true
+		}
+	}
+	return false
+}
+
+// AddEndpoint adds an endpoint to a running node, and returns it.
+// Channels of the endpoint are opened and emit EventChannelOpen as usual.
+func (n *Node) AddEndpoint(conf EndpointConf) (Endpoint, error) {
+	ca, ch, err := n.initEndpoint(conf, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(chan error)
+	n.eventsIn <- &eventInAddEndpoint{ca, ch, res}
+	err = <-res
+	if err != nil {
+		return nil, err
+	}
+
+	if ca != nil {
+		return ca.eca, nil
+	}
+	return ch.Endpoint, nil
+}
+
+// RemoveEndpoint removes an endpoint from a running node, closing all its
+// channels, that emit EventChannelClose. Frames that are queued for writing
+// are written before channels are closed.
+// Endpoints can be obtained from AddEndpoint() or from the Endpoint field of
+// channels.
+func (n *Node) RemoveEndpoint(e Endpoint) error {
+	res := make(chan error)
+	n.eventsIn <- &eventInRemoveEndpoint{e, res}
+	return <-res
+}
+
 // Close halts node operations and waits for all routines to return.
 func (n *Node) Close() {
 	// consume events up to close()
@@ -308,6 +785,7 @@ func (n *Node) Close() {
 
 	n.eventsIn <- &eventInClose{}
 	n.pool.Wait()
+	n.closeSubscriptions()
 	close(n.eventsIn)
 	close(n.eventsOut)
 }
@@ -318,43 +796,174 @@ func (n *Node) Close() {
 //   *EventFrame
 //   *EventParseError
 //   *EventStreamRequested
+//   *EventChannelStats
+//   *EventSystemAppeared
+//   *EventSystemLost
+//   *EventLinkChange
+//   *EventCommandProgress
+//   *EventParamChange
+//   *EventParamSet
+//   *EventMissionChange
+//   *EventMissionSetCurrent
 // See individual events for meaning and content.
+// The channel must be read continuously, since the node is blocked until
+// events are consumed, unless EventsDisable is true. Subscribe() provides
+// independent and filtered streams of events.
 func (n *Node) Events() chan Event {
 	return n.eventsOut
 }
 
+// RemoteSystems returns the systems and components that are sending heartbeats,
+// sorted by system id and component id.
+// Systems are removed when they stop sending heartbeats for HeartbeatTimeout.
+func (n *Node) RemoteSystems() []*RemoteSystem {
+	if n.nodeRegistry == nil {
+		return nil
+	}
+	return n.nodeRegistry.list()
+}
+
+// Stats returns the statistics of all open channels.
+func (n *Node) Stats() map[*Channel]*ChannelStats {
+	res := make(chan []*Channel, 1)
+	n.eventsIn <- &eventInChannels{res}
+
+	ret := make(map[*Channel]*ChannelStats)
+	for _, ch := range <-res {
+		ret[ch] = ch.Stats()
+	}
+	return ret
+}
+
+// Timesync returns the estimated offset between the clock of a remote system
+// and the local clock. It requires TimesyncEnable and a remote system that
+// answers to TIMESYNC requests.
+func (n *Node) Timesync(systemId byte, componentId byte) (TimesyncEstimate, bool) {
+	if n.nodeTimesync == nil {
+		return TimesyncEstimate{}, false
+	}
+	return n.nodeTimesync.estimate(systemId, componentId)
+}
+
+// RemoteTimeUsec converts a timestamp in microseconds produced by a remote
+// system, like the time_usec field of many messages, into local wall time.
+// Timestamps that are already in Unix time are converted directly.
+func (n *Node) RemoteTimeUsec(systemId byte, componentId byte, usec uint64) (time.Time, bool) {
+	if usec >= _TIMESYNC_UNIX_THRESHOLD_USEC {
+		return time.Unix(0, int64(usec)*1000), true
+	}
+
+	est, ok := n.Timesync(systemId, componentId)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(usec)*1000-int64(est.Offset)), true
+}
+
+// RemoteTimeBootMs converts the time_boot_ms field of a message produced by
+// a remote system into local wall time.
+func (n *Node) RemoteTimeBootMs(systemId byte, componentId byte, ms uint32) (time.Time, bool) {
+	return n.RemoteTimeUsec(systemId, componentId, uint64(ms)*1000)
+}
+
+// SetHeartbeatState changes the mode and status advertised by the heartbeats
+// of the node.
+func (n *Node) SetHeartbeatState(baseMode uint8, customMode uint32, systemStatus uint8) {
+	if n.nodeHeartbeat == nil {
+		return
+	}
+	n.nodeHeartbeat.setState(baseMode, customMode, systemStatus)
+}
+
+// SetHeartbeatComponent adds an additional component to the heartbeats of
+// the node, or updates it if it was already added. Heartbeats of additional
+// components are sent with their component id and the system id of the node.
+func (n *Node) SetHeartbeatComponent(c HeartbeatComponent) error {
+	if n.nodeHeartbeat == nil {
+		return fmt.Errorf("heartbeats are disabled")
+	}
+	return n.nodeHeartbeat.setComponent(c)
+}
+
+// RemoveHeartbeatComponent removes an additional component from the heartbeats
+// of the node.
+func (n *Node) RemoveHeartbeatComponent(componentId byte) {
+	if n.nodeHeartbeat == nil {
+		return
+	}
+	n.nodeHeartbeat.removeComponent(componentId)
+}
+
 // WriteMessageTo writes a message to given channel.
 func (n *Node) WriteMessageTo(channel *Channel, message Message) {
-	n.eventsIn <- &eventInWriteTo{channel, message}
+	n.writeTo(channel, message)
+}
+
+// TryWriteMessageTo writes a message to given channel. Unlike WriteMessageTo(),
+// it returns ErrWriteQueueFull instead of waiting when the outgoing queue of
+// the channel is full, and ErrChannelClosed when the channel has been closed.
+func (n *Node) TryWriteMessageTo(channel *Channel, message Message) error {
+	res := make(chan error)
+	n.eventsIn <- &eventInTryWriteTo{channel, message, res}
+	return <-res
 }
 
 // WriteMessageAll writes a message to all channels.
 func (n *Node) WriteMessageAll(message Message) {
-	n.eventsIn <- &eventInWriteAll{message}
+	n.writeAll(message)
 }
 
 // WriteMessageExcept writes a message to all channels except specified channel.
 func (n *Node) WriteMessageExcept(exceptChannel *Channel, message Message) {
-	n.eventsIn <- &eventInWriteExcept{exceptChannel, message}
+	n.writeExcept(exceptChannel, message)
+}
+
+// WriteMessageRouted writes a message to the channels where its target has been seen.
+// Messages without a target, broadcast messages and messages addressed to an
+// unknown target are written to all channels.
+func (n *Node) WriteMessageRouted(message Message) {
+	n.writeRouted(nil, message)
 }
 
 // WriteFrameTo writes a frame to given channel.
 // This function is intended only for routing pre-existing frames to other nodes,
 // since all frame fields must be filled manually.
 func (n *Node) WriteFrameTo(channel *Channel, frame Frame) {
-	n.eventsIn <- &eventInWriteTo{channel, frame}
+	n.writeTo(channel, frame)
+}
+
+// TryWriteFrameTo writes a frame to given channel. Unlike WriteFrameTo(),
+// it returns ErrWriteQueueFull instead of waiting when the outgoing queue of
+// the channel is full, and ErrChannelClosed when the channel has been closed.
+// This function is intended only for routing pre-existing frames to other nodes,
+// since all frame fields must be filled manually.
+func (n *Node) TryWriteFrameTo(channel *Channel, frame Frame) error {
+	res := make(chan error)
+	n.eventsIn <- &eventInTryWriteTo{channel, frame, res}
+	return <-res
 }
 
 // WriteFrameAll writes a frame to all channels.
 // This function is intended only for routing pre-existing frames to other nodes,
 // since all frame fields must be filled manually.
 func (n *Node) WriteFrameAll(frame Frame) {
-	n.eventsIn <- &eventInWriteAll{frame}
+	n.writeAll(frame)
 }
 
 // WriteFrameExcept writes a frame to all channels except specified channel.
 // This function is intended only for routing pre-existing frames to other nodes,
 // since all frame fields must be filled manually.
 func (n *Node) WriteFrameExcept(exceptChannel *Channel, frame Frame) {
-	n.eventsIn <- &eventInWriteExcept{exceptChannel, frame}
+	n.writeExcept(exceptChannel, frame)
+}
+
+// WriteFrameRouted writes a frame to the channels where its target has been seen,
+// following the Mavlink routing rules, and never to the source channel.
+// Frames without a target, broadcast frames, frames addressed to an unknown target
+// and frames that cannot be decoded with the dialect are written to every
+// other channel, like WriteFrameExcept() does.
+// This function is intended only for routing pre-existing frames to other nodes,
+// since all frame fields must be filled manually.
+func (n *Node) WriteFrameRouted(sourceChannel *Channel, frame Frame) {
+	n.writeRouted(sourceChannel, frame)
 }
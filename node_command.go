@@ -0,0 +1,317 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// MAV_RESULT values
+	_MAV_RESULT_ACCEPTED    = 0
+	_MAV_RESULT_IN_PROGRESS = 5
+
+	// maximum interval between two progress updates of a command
+	_COMMAND_PROGRESS_TIMEOUT = 5 * time.Second
+)
+
+// ErrCommandTimeout is returned when a command is not acknowledged by the target.
+var ErrCommandTimeout = fmt.Errorf("command timed out")
+
+// CommandTarget is the system and component to which a command is addressed.
+type CommandTarget struct {
+	SystemId byte
+	// component id, 0 to address all components of the system
+	ComponentId byte
+}
+
+// CommandIntParams contains the parameters of a command sent with COMMAND_INT.
+type CommandIntParams struct {
+	// coordinate system of the command (MAV_FRAME)
+	Frame uint8
+	// parameters 1 to 4
+	Params [4]float32
+	// local x position or latitude * 10^7
+	X int32
+	// local y position or longitude * 10^7
+	Y int32
+	// z position, global: altitude in meters
+	Z float32
+}
+
+// CommandResult contains the content of the COMMAND_ACK sent by the target
+// in response to a command.
+type CommandResult struct {
+	// the system id of the component that acknowledged the command
+	SystemId byte
+	// the component id of the component that acknowledged the command
+	ComponentId byte
+	// the command result (MAV_RESULT)
+	Result int
+	// the progress percentage, if provided
+	Progress uint8
+	// additional result information, specific to the command
+	ResultParam2 int32
+}
+
+// CommandError is the error returned when a command is acknowledged
+// with a result that is not MAV_RESULT_ACCEPTED.
+type CommandError struct {
+	Command uint16
+	Result  int
+}
+
+// Error implements the error interface.
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %d not accepted (result %d)", e.Command, e.Result)
+}
+
+// commandKey identifies a pending command. Channel is nil when the command
+// is routed, otherwise acks are accepted only from the given channel.
+type commandKey struct {
+	Channel     *Channel
+	SystemId    byte
+	ComponentId byte
+	Command     uint16
+}
+
+type nodeCommand struct {
+	n            *Node
+	pendingMutex sync.Mutex
+	pending      map[commandKey]chan *CommandResult
+}
+
+func newNodeCommand(n *Node) *nodeCommand {
+	// command messages must exist in dialect and correspond to standard
+	if dialectHasMessage(n.conf.D, 76, 152) == false || // COMMAND_LONG
+		dialectHasMessage(n.conf.D, 77, 143) == false { // COMMAND_ACK
+		return nil
+	}
+
+	c := &nodeCommand{
+		n:       n,
+		pending: make(map[commandKey]chan *CommandResult),
+	}
+
+	return c
+}
+
+func (c *nodeCommand) onEventFrame(evt *EventFrame) {
+	msg := evt.Message()
+	if msg.GetId() != 77 {
+		return
+	}
+
+	command, ok := messageFieldUint(msg, "command")
+	if ok == false {
+		return
+	}
+
+	// discard acks addressed to other nodes
+	if ts, ok := messageFieldUint(msg, "target_system"); ok && ts != 0 &&
+		byte(ts) != c.n.conf.OutSystemId {
+		return
+	}
+
+	result, _ := messageFieldUint(msg, "result")
+	progress, _ := messageFieldUint(msg, "progress")
+	resultParam2, _ := messageFieldUint(msg, "result_param2")
+
+	res := &CommandResult{
+		SystemId:     evt.SystemId(),
+		ComponentId:  evt.ComponentId(),
+		Result:       int(result),
+		Progress:     uint8(progress),
+		ResultParam2: int32(resultParam2),
+	}
+
+	found := func() bool {
+		c.pendingMutex.Lock()
+		defer c.pendingMutex.Unlock()
+
+		// commands may have been sent through a specific channel or
+		// addressed to all components
+		for _, key := range []commandKey{
+			{evt.Channel, evt.SystemId(), evt.ComponentId(), uint16(command)},
+			{evt.Channel, evt.SystemId(), 0, uint16(command)},
+			{nil, evt.SystemId(), evt.ComponentId(), uint16(command)},
+			{nil, evt.SystemId(), 0, uint16(command)},
+		} {
+			if ch, ok := c.pending[key]; ok {
+				select {
+				case ch <- res:
+				default:
+				}
+				return true
+			}
+		}
+		return false
+	}()
+
+	if found && res.Result == _MAV_RESULT_IN_PROGRESS {
+		c.n.emitEvent(&EventCommandProgress{
+			Channel:     evt.Channel,
+			SystemId:    evt.SystemId(),
+			ComponentId: evt.ComponentId(),
+			Command:     uint16(command),
+			Progress:    res.Progress,
+		})
+	}
+}
+
+// send sends a command and waits for its ack. If ch is nil, the command is
+// routed, otherwise it is written to ch.
+func (c *nodeCommand) send(ctx context.Context, ch *Channel, target CommandTarget, command uint16,
+	build func(confirmation uint8) (Message, error)) (*CommandResult, error) {
+	key := commandKey{ch, target.SystemId, target.ComponentId, command}
+	acks := make(chan *CommandResult, 8)
+
+	err := func() error {
+		c.pendingMutex.Lock()
+		defer c.pendingMutex.Unlock()
+
+		// acks do not contain any identifier, therefore only one command
+		// of a given type can be sent to a target at once
+		if _, ok := c.pending[key]; ok {
+			return fmt.Errorf("command %d is already pending for this target", command)
+		}
+		c.pending[key] = acks
+		return nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		c.pendingMutex.Lock()
+		defer c.pendingMutex.Unlock()
+		delete(c.pending, key)
+	}()
+
+	confirmation := 0
+	inProgress := false
+
+	for {
+		timeout := c.n.conf.CommandTimeout
+		if inProgress {
+			timeout = _COMMAND_PROGRESS_TIMEOUT
+		} else {
+			// do not write after the context has been canceled, since the node
+			// may be closing
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			msg, err := build(uint8(confirmation))
+			if err != nil {
+				return nil, err
+			}
+			if ch != nil {
+				c.n.WriteMessageTo(ch, msg)
+			} else {
+				c.n.WriteMessageRouted(msg)
+			}
+		}
+
+		timer := time.NewTimer(timeout)
+
+		select {
+		case res := <-acks:
+			timer.Stop()
+
+			switch res.Result {
+			case _MAV_RESULT_ACCEPTED:
+				return res, nil
+
+			// the command is being executed, stop retransmitting it
+			// and wait for the final result
+			case _MAV_RESULT_IN_PROGRESS:
+				inProgress = true
+
+			default:
+				return res, &CommandError{command, res.Result}
+			}
+
+		case <-timer.C:
+			if inProgress || confirmation >= c.n.conf.CommandRetries {
+				return nil, ErrCommandTimeout
+			}
+			confirmation++
+
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SendCommandLong sends a command to a target with COMMAND_LONG and waits for
+// the corresponding COMMAND_ACK. The command is sent again, with an incremented
+// confirmation field, if the target does not acknowledge it within CommandTimeout.
+// If the target reports that the command is in progress, an EventCommandProgress
+// is emitted and the function waits for the final result.
+// A CommandError is returned if the command is not accepted.
+// This function must not be called by the routine that reads Events(), since
+// incoming frames are not processed until events are consumed.
+func (n *Node) SendCommandLong(ctx context.Context, target CommandTarget,
+	command uint16, params [7]float32) (*CommandResult, error) {
+	return n.sendCommandLong(ctx, nil, target, command, params)
+}
+
+// sendCommandLong is like SendCommandLong, but the command is written to
+// the given channel instead of being routed, unless the channel is nil.
+func (n *Node) sendCommandLong(ctx context.Context, ch *Channel, target CommandTarget,
+	command uint16, params [7]float32) (*CommandResult, error) {
+	if n.nodeCommand == nil {
+		return nil, fmt.Errorf("the dialect does not support the command protocol")
+	}
+
+	return n.nodeCommand.send(ctx, ch, target, command, func(confirmation uint8) (Message, error) {
+		msg := dialectNewMessage(n.conf.D, 76)
+		err := messageSetFields(msg, map[string]interface{}{
+			"target_system":    target.SystemId,
+			"target_component": target.ComponentId,
+			"command":          command,
+			"confirmation":     confirmation,
+			"param1":           params[0],
+			"param2":           params[1],
+			"param3":           params[2],
+			"param4":           params[3],
+			"param5":           params[4],
+			"param6":           params[5],
+			"param7":           params[6],
+		})
+		return msg, err
+	})
+}
+
+// SendCommandInt sends a command to a target with COMMAND_INT and waits for
+// the corresponding COMMAND_ACK. Since COMMAND_INT does not have a confirmation
+// field, the command is sent again unchanged in case of timeout.
+// See SendCommandLong for details.
+func (n *Node) SendCommandInt(ctx context.Context, target CommandTarget,
+	command uint16, params CommandIntParams) (*CommandResult, error) {
+	if n.nodeCommand == nil ||
+		dialectHasMessage(n.conf.D, 75, 158) == false { // COMMAND_INT
+		return nil, fmt.Errorf("the dialect does not support the command protocol")
+	}
+
+	return n.nodeCommand.send(ctx, nil, target, command, func(confirmation uint8) (Message, error) {
+		msg := dialectNewMessage(n.conf.D, 75)
+		err := messageSetFields(msg, map[string]interface{}{
+			"target_system":    target.SystemId,
+			"target_component": target.ComponentId,
+			"frame":            params.Frame,
+			"command":          command,
+			"param1":           params.Params[0],
+			"param2":           params.Params[1],
+			"param3":           params.Params[2],
+			"param4":           params.Params[3],
+			"x":                params.X,
+			"y":                params.Y,
+			"z":                params.Z,
+		})
+		return msg, err
+	})
+}
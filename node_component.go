@@ -0,0 +1,73 @@
+package gomavlib
+
+import "fmt"
+
+// NodeComponent is a component of the system of a Node, with its own
+// component id. Messages written through a NodeComponent share the endpoints
+// of the Node, but have their own component id and sequence ids.
+type NodeComponent struct {
+	n           *Node
+	componentId byte
+}
+
+// Component registers a component of the system of the node and returns
+// a handle that allows to write messages on behalf of it. It returns an error
+// if the component id is 0 (MAV_COMP_ID_ALL), OutComponentId (that is used by
+// the node itself) or a component that has already been registered and has
+// not been closed.
+func (n *Node) Component(componentId byte) (*NodeComponent, error) {
+	if componentId == 0 || componentId == n.conf.OutComponentId {
+		return nil, fmt.Errorf("invalid component id: %d", componentId)
+	}
+
+	n.componentsMutex.Lock()
+	defer n.componentsMutex.Unlock()
+
+	if _, ok := n.components[componentId]; ok {
+		return nil, fmt.Errorf("component %d is already registered", componentId)
+	}
+
+	c := &NodeComponent{
+		n:           n,
+		componentId: componentId,
+	}
+	n.components[componentId] = c
+	return c, nil
+}
+
+// Close unregisters the component, in such way that its component id can be
+// registered again. The handle must not be used after it has been closed.
+func (c *NodeComponent) Close() {
+	c.n.componentsMutex.Lock()
+	defer c.n.componentsMutex.Unlock()
+
+	if c.n.components[c.componentId] == c {
+		delete(c.n.components, c.componentId)
+	}
+}
+
+// ComponentId returns the component id.
+func (c *NodeComponent) ComponentId() byte {
+	return c.componentId
+}
+
+// WriteMessageTo writes a message to given channel.
+func (c *NodeComponent) WriteMessageTo(channel *Channel, message Message) {
+	c.n.writeTo(channel, &componentMessage{c.componentId, message})
+}
+
+// WriteMessageAll writes a message to all channels.
+func (c *NodeComponent) WriteMessageAll(message Message) {
+	c.n.writeAll(&componentMessage{c.componentId, message})
+}
+
+// WriteMessageExcept writes a message to all channels except specified channel.
+func (c *NodeComponent) WriteMessageExcept(exceptChannel *Channel, message Message) {
+	c.n.writeExcept(exceptChannel, &componentMessage{c.componentId, message})
+}
+
+// WriteMessageRouted writes a message to the channels that lead to its target.
+// See Node.WriteMessageRouted().
+func (c *NodeComponent) WriteMessageRouted(message Message) {
+	c.n.writeRouted(nil, &componentMessage{c.componentId, message})
+}
@@ -0,0 +1,96 @@
+package gomavlib
+
+import (
+	"sync"
+	"time"
+)
+
+type dedupKey struct {
+	systemId    byte
+	componentId byte
+	sequenceId  byte
+	messageId   uint32
+	checksum    uint16
+}
+
+type dedupEntry struct {
+	ch   *Channel
+	time time.Time
+}
+
+// nodeDedup discards frames that have already been received through another
+// channel, in setups where the same system is reachable through redundant links.
+type nodeDedup struct {
+	n         *Node
+	terminate chan struct{}
+
+	mutex   sync.Mutex
+	entries map[dedupKey]dedupEntry
+}
+
+func newNodeDedup(n *Node) *nodeDedup {
+	// module is disabled. Links always need it.
+	if n.conf.DedupEnable == false && len(n.conf.Links) == 0 {
+		return nil
+	}
+
+	d := &nodeDedup{
+		n:         n,
+		terminate: make(chan struct{}, 1),
+		entries:   make(map[dedupKey]dedupEntry),
+	}
+
+	return d
+}
+
+func (d *nodeDedup) close() {
+	d.terminate <- struct{}{}
+}
+
+func (d *nodeDedup) run() {
+	ticker := time.NewTicker(d.n.conf.DedupWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			func() {
+				d.mutex.Lock()
+				defer d.mutex.Unlock()
+
+				for key, e := range d.entries {
+					if now.Sub(e.time) >= d.n.conf.DedupWindow {
+						delete(d.entries, key)
+					}
+				}
+			}()
+
+		case <-d.terminate:
+			return
+		}
+	}
+}
+
+// isDuplicate returns whether a frame has already been received through
+// another channel within DedupWindow.
+func (d *nodeDedup) isDuplicate(ch *Channel, f Frame) bool {
+	key := dedupKey{
+		systemId:    f.GetSystemId(),
+		componentId: f.GetComponentId(),
+		sequenceId:  f.GetSequenceId(),
+		messageId:   f.GetMessage().GetId(),
+		checksum:    f.GetChecksum(),
+	}
+	now := time.Now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	e, ok := d.entries[key]
+	if ok && e.ch != ch && now.Sub(e.time) < d.n.conf.DedupWindow {
+		return true
+	}
+
+	d.entries[key] = dedupEntry{ch, now}
+	return false
+}
@@ -0,0 +1,117 @@
+package gomavlib
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	handlerChannelType = reflect.TypeOf((*Channel)(nil))
+	handlerFrameType   = reflect.TypeOf((*Frame)(nil)).Elem()
+)
+
+// MessageHandler is a callback registered with Handle() or HandleName().
+type MessageHandler struct {
+	n *Node
+	l *frameListener
+}
+
+// Remove removes the callback.
+func (h *MessageHandler) Remove() {
+	h.n.removeFrameListener(h.l)
+}
+
+// Handle registers a callback that is called every time a message with the
+// same type of msg is received. The callback must be a
+// func(*Channel, Frame, *MessageType), where *MessageType is the type of msg,
+// or a func(*Channel, Frame, Message), that is called without reflection and
+// is therefore faster.
+// It requires a DialectCT that contains the message.
+// Callbacks are called by the routines that read channels, before frames are
+// emitted to Events(), therefore they must return quickly.
+func (n *Node) Handle(msg Message, cb interface{}) (*MessageHandler, error) {
+	d, ok := n.conf.D.(*DialectCT)
+	if !ok {
+		return nil, fmt.Errorf("Handle() requires a DialectCT")
+	}
+
+	msgType := reflect.TypeOf(msg)
+	if msgType == nil || msgType.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("message must be a pointer to a struct")
+	}
+
+	mp, ok := d.Messages[msg.GetId()]
+	if !ok || mp.elemType != msgType.Elem() {
+		return nil, fmt.Errorf("message %s is not in the dialect", msgType.Elem().Name())
+	}
+
+	var handler func(*EventFrame)
+
+	if fcb, ok := cb.(func(*Channel, Frame, Message)); ok {
+		handler = func(evt *EventFrame) {
+			fcb(evt.Channel, evt.Frame, evt.Message())
+		}
+
+	} else {
+		cbType := reflect.TypeOf(cb)
+		if cbType == nil || cbType.Kind() != reflect.Func ||
+			cbType.NumIn() != 3 ||
+			cbType.In(0) != handlerChannelType ||
+			cbType.In(1) != handlerFrameType ||
+			cbType.In(2) != msgType ||
+			cbType.NumOut() != 0 {
+			return nil, fmt.Errorf("callback must have signature func(*Channel, Frame, %s)", msgType)
+		}
+		cbValue := reflect.ValueOf(cb)
+
+		handler = func(evt *EventFrame) {
+			cbValue.Call([]reflect.Value{
+				reflect.ValueOf(evt.Channel),
+				reflect.ValueOf(&evt.Frame).Elem(),
+				reflect.ValueOf(evt.Message()),
+			})
+		}
+	}
+
+	// frames with the same id but decoded by another dialect are skipped
+	l := n.addMessageHandler(msg.GetId(), func(evt *EventFrame) bool {
+		return reflect.TypeOf(evt.Message()) == msgType
+	}, handler)
+
+	return &MessageHandler{n, l}, nil
+}
+
+// HandleName registers a callback that is called every time a message with
+// the given name (i.e. ATTITUDE) is received. It requires a DialectRT that
+// contains the message. See Handle() for details.
+func (n *Node) HandleName(name string, cb func(*Channel, Frame, *DynamicMessage)) (*MessageHandler, error) {
+	d, ok := n.conf.D.(*DialectRT)
+	if !ok {
+		return nil, fmt.Errorf("HandleName() requires a DialectRT")
+	}
+
+	if cb == nil {
+		return nil, fmt.Errorf("callback not provided")
+	}
+
+	found := false
+	var id uint32
+	for mid, m := range d.Messages {
+		if m.Msg.OriginalName == name {
+			id = mid
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("message %s is not in the dialect", name)
+	}
+
+	l := n.addMessageHandler(id, nil, func(evt *EventFrame) {
+		if msg, ok := evt.Message().(*DynamicMessage); ok {
+			cb(evt.Channel, evt.Frame, msg)
+		}
+	})
+
+	return &MessageHandler{n, l}, nil
+}
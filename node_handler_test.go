@@ -0,0 +1,113 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeHandle(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageSystemTime{}}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			node1, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      10,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node1.Close()
+			go func() {
+				for range node1.Events() {
+				}
+			}()
+
+			node2, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      11,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node2.Close()
+			go func() {
+				for range node2.Events() {
+				}
+			}()
+
+			received := make(chan uint64, 10)
+			var h *MessageHandler
+			var hGeneric *MessageHandler
+
+			if ca.name == "static" {
+				_, err = node1.HandleName("SYSTEM_TIME", func(*Channel, Frame, *DynamicMessage) {})
+				require.Error(t, err)
+				_, err = node1.Handle(&MessageSystemTime{}, func(*Channel, Frame, *MessageHeartbeat) {})
+				require.Error(t, err)
+				_, err = node1.Handle(&MessageParamValue{}, func(*Channel, Frame, *MessageParamValue) {})
+				require.Error(t, err)
+
+				h, err = node1.Handle(&MessageSystemTime{}, func(ch *Channel, f Frame, msg *MessageSystemTime) {
+					require.NotNil(t, ch)
+					require.Equal(t, byte(11), f.GetSystemId())
+					received <- msg.TimeUnixUsec
+				})
+				require.NoError(t, err)
+
+				hGeneric, err = node1.Handle(&MessageSystemTime{}, func(ch *Channel, f Frame, msg Message) {
+					received <- msg.(*MessageSystemTime).TimeUnixUsec
+				})
+				require.NoError(t, err)
+
+			} else {
+				_, err = node1.Handle(&MessageSystemTime{}, func(*Channel, Frame, *MessageSystemTime) {})
+				require.Error(t, err)
+				_, err = node1.HandleName("PARAM_VALUE", func(*Channel, Frame, *DynamicMessage) {})
+				require.Error(t, err)
+
+				h, err = node1.HandleName("SYSTEM_TIME", func(ch *Channel, f Frame, msg *DynamicMessage) {
+					require.NotNil(t, ch)
+					require.Equal(t, byte(11), f.GetSystemId())
+					v, _ := messageFieldUint(msg, "time_unix_usec")
+					received <- v
+				})
+				require.NoError(t, err)
+			}
+
+			node2.WriteMessageAll(&MessageHeartbeat{})
+			node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 1})
+			require.Equal(t, uint64(1), <-received)
+			if hGeneric != nil {
+				require.Equal(t, uint64(1), <-received)
+			}
+
+			// events are emitted after handlers are called
+			sub := node1.Subscribe(SubscriptionConf{
+				Filter: SubscriptionFilter{MessageIds: []uint32{0}},
+			})
+			defer sub.Unsubscribe()
+
+			h.Remove()
+			if hGeneric != nil {
+				hGeneric.Remove()
+			}
+			node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 2})
+			node2.WriteMessageAll(&MessageHeartbeat{})
+			<-sub.Events()
+			require.Equal(t, 0, len(received))
+		})
+	}
+}
@@ -1,12 +1,41 @@
 package gomavlib
 
 import (
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 )
 
+const (
+	_MAV_STATE_ACTIVE = 4
+)
+
+// HeartbeatComponent is an additional component advertised by the heartbeats
+// of a Node.
+type HeartbeatComponent struct {
+	// the component id
+	ComponentId byte
+	// the component type (MAV_TYPE)
+	Type int
+	// the autopilot type (MAV_AUTOPILOT). Components that are not flight
+	// controllers should use MAV_AUTOPILOT_INVALID.
+	Autopilot int
+	// the system mode bitmap (MAV_MODE_FLAG)
+	BaseMode uint8
+	// the autopilot-specific mode
+	CustomMode uint32
+	// the system status (MAV_STATE)
+	SystemStatus uint8
+}
+
 type nodeHeartbeat struct {
 	n         *Node
 	terminate chan struct{}
+
+	mutex      sync.Mutex
+	main       HeartbeatComponent
+	components map[byte]HeartbeatComponent
 }
 
 func newNodeHeartbeat(n *Node) *nodeHeartbeat {
@@ -29,6 +58,13 @@ func newNodeHeartbeat(n *Node) *nodeHeartbeat {
 	h := &nodeHeartbeat{
 		n:         n,
 		terminate: make(chan struct{}, 1),
+		main: HeartbeatComponent{
+			ComponentId:  n.conf.OutComponentId,
+			Type:         n.conf.HeartbeatSystemType,
+			Autopilot:    n.conf.HeartbeatAutopilotType,
+			SystemStatus: _MAV_STATE_ACTIVE,
+		},
+		components: make(map[byte]HeartbeatComponent),
 	}
 
 	return h
@@ -51,24 +87,12 @@ func (h *nodeHeartbeat) run() {
 	for {
 		select {
 		case <-ticker.C:
-			dm, _ := h.n.conf.D.getMsgById(0)
-			msg := (*dm).newMsg()
-			if _, ok := msg.(*DynamicMessage); ok {
-				msg.SetField("type", uint8(h.n.conf.HeartbeatSystemType))
-				msg.SetField("autopilot", uint8(h.n.conf.HeartbeatAutopilotType))
-				msg.SetField("base_mode", uint8(0))
-				msg.SetField("custom_mode", uint32(0))
-				msg.SetField("system_status", uint8(4)) // MAV_STATE_ACTIVE
-				msg.SetField("mavlink_version", uint8(mavlinkVersion))
-				h.n.WriteMessageAll(msg)
-			} else {
-				msg.SetField("Type", int8(h.n.conf.HeartbeatSystemType))
-				msg.SetField("Autopilot", int8(h.n.conf.HeartbeatAutopilotType))
-				msg.SetField("BaseMode", int8(0))
-				msg.SetField("CustomMode", uint32(0))
-				msg.SetField("SystemStatus", int8(4)) // MAV_STATE_ACTIVE
-				msg.SetField("MavlinkVersion", uint8(mavlinkVersion))
-				h.n.WriteMessageAll(msg)
+			main, components := h.state()
+
+			h.n.WriteMessageAll(h.newHeartbeat(main, mavlinkVersion))
+
+			for _, c := range components {
+				h.n.writeAll(&componentMessage{c.ComponentId, h.newHeartbeat(c, mavlinkVersion)})
 			}
 
 		case <-h.terminate:
@@ -76,3 +100,61 @@ func (h *nodeHeartbeat) run() {
 		}
 	}
 }
+
+func (h *nodeHeartbeat) newHeartbeat(c HeartbeatComponent, mavlinkVersion uint64) Message {
+	msg := dialectNewMessage(h.n.conf.D, 0)
+	messageSetFields(msg, map[string]interface{}{
+		"type":            uint8(c.Type),
+		"autopilot":       uint8(c.Autopilot),
+		"base_mode":       c.BaseMode,
+		"custom_mode":     c.CustomMode,
+		"system_status":   c.SystemStatus,
+		"mavlink_version": uint8(mavlinkVersion),
+	})
+	return msg
+}
+
+// state returns the main component and the additional components,
+// sorted by component id.
+func (h *nodeHeartbeat) state() (HeartbeatComponent, []HeartbeatComponent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	components := make([]HeartbeatComponent, 0, len(h.components))
+	for _, c := range h.components {
+		components = append(components, c)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].ComponentId < components[j].ComponentId
+	})
+
+	return h.main, components
+}
+
+func (h *nodeHeartbeat) setState(baseMode uint8, customMode uint32, systemStatus uint8) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.main.BaseMode = baseMode
+	h.main.CustomMode = customMode
+	h.main.SystemStatus = systemStatus
+}
+
+func (h *nodeHeartbeat) setComponent(c HeartbeatComponent) error {
+	if c.ComponentId == 0 || c.ComponentId == h.n.conf.OutComponentId {
+		return fmt.Errorf("invalid component id: %d", c.ComponentId)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.components[c.ComponentId] = c
+	return nil
+}
+
+func (h *nodeHeartbeat) removeComponent(componentId byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.components, componentId)
+}
@@ -0,0 +1,399 @@
+package gomavlib
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LinkStrategy is the strategy used to write to the channels of a link.
+type LinkStrategy int
+
+const (
+	// LinkPrimaryBackup writes to the active channel only, that is the first
+	// healthy channel in the order of the link configuration.
+	LinkPrimaryBackup LinkStrategy = iota
+	// LinkBroadcast writes to all the channels of the link.
+	LinkBroadcast
+)
+
+// LinkConf configures a Link.
+type LinkConf struct {
+	// the name of the link
+	Name string
+	// the endpoints of the link, in order of preference
+	Endpoints []EndpointConf
+	// (optional) the strategy used to write to the channels of the link.
+	// See LinkStrategy for the available options. It defaults to LinkPrimaryBackup.
+	Strategy LinkStrategy
+	// (optional) the time after which a channel that has not received any
+	// heartbeat is considered unhealthy. It defaults to 3 seconds.
+	Timeout time.Duration
+	// (optional) the packet loss percentage above which a channel is
+	// considered unhealthy. It defaults to 50.
+	MaxLossPercent float64
+}
+
+type linkChannel struct {
+	ch            *Channel
+	index         int
+	lastHeartbeat time.Time
+	prevReceived  uint64
+	prevLost      uint64
+	lossPercent   float64
+}
+
+// Link is a group of redundant endpoints, that are used as a single logical
+// link with a given strategy. The channels of a link are checked periodically:
+// a channel is healthy when it has received a heartbeat within Timeout and its
+// packet loss is below MaxLossPercent. The active channel is the first healthy
+// one in order of preference, i.e. a backup channel is used only until the
+// preferred one is healthy again, even if the backup is in better shape.
+// The strategy applies to the writes of the link and to the node-level writes
+// (WriteMessageAll(), WriteMessageRouted(), etc). Frames received through the
+// channels of a link are deduplicated.
+type Link struct {
+	n    *Node
+	conf LinkConf
+
+	mutex    sync.Mutex
+	channels []*linkChannel
+	active   *Channel
+}
+
+// Name returns the name of the link.
+func (l *Link) Name() string {
+	return l.conf.Name
+}
+
+// Channel returns the active channel of the link, or nil if the link has no
+// open channels.
+func (l *Link) Channel() *Channel {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.active
+}
+
+// Channels returns the open channels of the link, in order of preference.
+func (l *Link) Channels() []*Channel {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ret := make([]*Channel, len(l.channels))
+	for i, lc := range l.channels {
+		ret[i] = lc.ch
+	}
+	return ret
+}
+
+func (l *Link) write(what interface{}) error {
+	var channels []*Channel
+	if l.conf.Strategy == LinkBroadcast {
+		channels = l.Channels()
+	} else if ch := l.Channel(); ch != nil {
+		channels = []*Channel{ch}
+	}
+
+	if len(channels) == 0 {
+		return fmt.Errorf("link %s has no open channels", l.conf.Name)
+	}
+
+	for _, ch := range channels {
+		l.n.writeTo(ch, what)
+	}
+	return nil
+}
+
+// WriteMessage writes a message to the link, following its strategy.
+func (l *Link) WriteMessage(message Message) error {
+	return l.write(message)
+}
+
+// WriteFrame writes a frame to the link, following its strategy.
+// This function is intended only for routing pre-existing frames to other nodes,
+// since all frame fields must be filled manually.
+func (l *Link) WriteFrame(frame Frame) error {
+	return l.write(frame)
+}
+
+func (l *Link) healthy(lc *linkChannel, now time.Time) bool {
+	return !lc.lastHeartbeat.IsZero() &&
+		now.Sub(lc.lastHeartbeat) < l.conf.Timeout &&
+		lc.lossPercent <= l.conf.MaxLossPercent
+}
+
+// choose selects the active channel, that is the first healthy channel in
+// order of preference. It returns true if it has changed.
+// It must be called with the mutex locked.
+func (l *Link) choose(now time.Time) bool {
+	var active *Channel
+
+	for _, lc := range l.channels {
+		if l.healthy(lc, now) {
+			active = lc.ch
+			break
+		}
+	}
+
+	// no healthy channels: keep the current one if it is still open,
+	// otherwise use the preferred one.
+	if active == nil {
+		for _, lc := range l.channels {
+			if lc.ch == l.active {
+				active = l.active
+				break
+			}
+		}
+	}
+	if active == nil && len(l.channels) > 0 {
+		active = l.channels[0].ch
+	}
+
+	if active == l.active {
+		return false
+	}
+	l.active = active
+	return true
+}
+
+func (l *Link) emitChange(ch *Channel) {
+	l.n.emitEvent(&EventLinkChange{
+		Link:    l,
+		Channel: ch,
+	})
+}
+
+// linkChannels applies the strategy of links to the channels selected by
+// node-level writes: the channels of links that use LinkPrimaryBackup are
+// replaced by the active channel of their link, and the channels of the link
+// of the source channel are skipped, in order not to send frames back through
+// the link they came from. It must be called by the node routine.
+func (n *Node) linkChannels(channels []*Channel, except *Channel) []*Channel {
+	if n.nodeLinks == nil {
+		return channels
+	}
+
+	var ret []*Channel
+	found := make(map[*Channel]struct{})
+
+	for _, ch := range channels {
+		if ch.link != nil {
+			if except != nil && ch.link == except.link {
+				continue
+			}
+
+			if ch.link.conf.Strategy == LinkPrimaryBackup {
+				ch = ch.link.Channel()
+
+				// channel may have been closed in the meanwhile
+				if _, ok := n.channels[ch]; !ok {
+					continue
+				}
+			}
+		}
+
+		if _, ok := found[ch]; ok {
+			continue
+		}
+		found[ch] = struct{}{}
+		ret = append(ret, ch)
+	}
+
+	return ret
+}
+
+// Links returns the links of the node, in the order of NodeConf.
+func (n *Node) Links() []*Link {
+	return n.links
+}
+
+// Link returns the link with the given name, or nil if it does not exist.
+func (n *Node) Link(name string) *Link {
+	for _, l := range n.links {
+		if l.conf.Name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+type nodeLinks struct {
+	n         *Node
+	terminate chan struct{}
+	links     []*Link
+}
+
+func newNodeLinks(n *Node, links []*Link) *nodeLinks {
+	// module is disabled
+	if len(links) == 0 {
+		return nil
+	}
+
+	nl := &nodeLinks{
+		n:         n,
+		terminate: make(chan struct{}, 1),
+		links:     links,
+	}
+
+	return nl
+}
+
+func (nl *nodeLinks) close() {
+	nl.terminate <- struct{}{}
+}
+
+func (nl *nodeLinks) run() {
+	period := nl.links[0].conf.Timeout
+	for _, l := range nl.links[1:] {
+		if l.conf.Timeout < period {
+			period = l.conf.Timeout
+		}
+	}
+
+	ticker := time.NewTicker(period / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, l := range nl.links {
+				nl.update(l, now)
+			}
+
+		case <-nl.terminate:
+			return
+		}
+	}
+}
+
+// update computes the packet loss of the channels of a link since the
+// previous update, then chooses the active channel.
+func (nl *nodeLinks) update(l *Link, now time.Time) {
+	type sample struct {
+		lc    *linkChannel
+		stats *ChannelStats
+	}
+
+	// read statistics without holding the link mutex
+	l.mutex.Lock()
+	samples := make([]sample, len(l.channels))
+	for i, lc := range l.channels {
+		samples[i].lc = lc
+	}
+	l.mutex.Unlock()
+	for i := range samples {
+		samples[i].stats = samples[i].lc.ch.Stats()
+	}
+
+	var changed bool
+	var active *Channel
+	func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		for _, s := range samples {
+			received := s.stats.Received() - s.lc.prevReceived
+			lost := s.stats.Lost() - s.lc.prevLost
+			if received+lost > 0 {
+				s.lc.lossPercent = float64(lost) * 100 / float64(received+lost)
+			}
+			s.lc.prevReceived = s.stats.Received()
+			s.lc.prevLost = s.stats.Lost()
+		}
+
+		changed = l.choose(now)
+		active = l.active
+	}()
+
+	if changed {
+		l.emitChange(active)
+	}
+}
+
+func (nl *nodeLinks) onChannelOpen(ch *Channel) {
+	l := ch.link
+	if l == nil {
+		return
+	}
+
+	var changed bool
+	var active *Channel
+	func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		l.channels = append(l.channels, &linkChannel{
+			ch:    ch,
+			index: ch.linkIndex,
+		})
+		sort.SliceStable(l.channels, func(i, j int) bool {
+			return l.channels[i].index < l.channels[j].index
+		})
+
+		changed = l.choose(time.Now())
+		active = l.active
+	}()
+
+	if changed {
+		l.emitChange(active)
+	}
+}
+
+func (nl *nodeLinks) onChannelClose(ch *Channel) {
+	l := ch.link
+	if l == nil {
+		return
+	}
+
+	var changed bool
+	var active *Channel
+	func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		for i, lc := range l.channels {
+			if lc.ch == ch {
+				l.channels = append(l.channels[:i], l.channels[i+1:]...)
+				break
+			}
+		}
+
+		changed = l.choose(time.Now())
+		active = l.active
+	}()
+
+	if changed {
+		l.emitChange(active)
+	}
+}
+
+func (nl *nodeLinks) onFrame(ch *Channel, frame Frame) {
+	l := ch.link
+	if l == nil || frame.GetMessage().GetId() != 0 {
+		return
+	}
+
+	now := time.Now()
+
+	var changed bool
+	var active *Channel
+	func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		for _, lc := range l.channels {
+			if lc.ch == ch {
+				lc.lastHeartbeat = now
+				break
+			}
+		}
+
+		changed = l.choose(now)
+		active = l.active
+	}()
+
+	if changed {
+		l.emitChange(active)
+	}
+}
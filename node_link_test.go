@@ -0,0 +1,221 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkChoose(t *testing.T) {
+	now := time.Now()
+	primary := &linkChannel{ch: &Channel{label: "primary"}, index: 0}
+	backup := &linkChannel{ch: &Channel{label: "backup"}, index: 1}
+
+	l := &Link{
+		conf: LinkConf{
+			Timeout:        time.Second,
+			MaxLossPercent: 50,
+		},
+		channels: []*linkChannel{primary, backup},
+	}
+
+	// no heartbeats: the preferred channel is used
+	require.Equal(t, true, l.choose(now))
+	require.Equal(t, primary.ch, l.active)
+
+	// the primary channel is not healthy
+	backup.lastHeartbeat = now
+	require.Equal(t, true, l.choose(now))
+	require.Equal(t, backup.ch, l.active)
+
+	// the primary channel is healthy again
+	primary.lastHeartbeat = now
+	require.Equal(t, true, l.choose(now))
+	require.Equal(t, primary.ch, l.active)
+
+	// the primary channel is losing packets
+	primary.lossPercent = 60
+	require.Equal(t, true, l.choose(now))
+	require.Equal(t, backup.ch, l.active)
+
+	// no channels are healthy: the current one is kept
+	require.Equal(t, false, l.choose(now.Add(2*time.Second)))
+	require.Equal(t, backup.ch, l.active)
+}
+
+func TestNodeLink(t *testing.T) {
+	for _, strategy := range []LinkStrategy{LinkPrimaryBackup, LinkBroadcast} {
+		t.Run(map[LinkStrategy]string{
+			LinkPrimaryBackup: "primary backup",
+			LinkBroadcast:     "broadcast",
+		}[strategy], func(t *testing.T) {
+			msgs := []Message{&MessageHeartbeat{}, &MessageSystemTime{}, &MessageParamRequestRead{}}
+			p1, p2 := net.Pipe()
+			p3, p4 := net.Pipe()
+
+			node1, err := NewNode(NodeConf{
+				D:           MustDialectCT(3, msgs),
+				OutVersion:  V2,
+				OutSystemId: 10,
+				Links: []LinkConf{{
+					Name:      "vehicle",
+					Endpoints: []EndpointConf{EndpointCustom{p1}, EndpointCustom{p3}},
+					Strategy:  strategy,
+					Timeout:   500 * time.Millisecond,
+				}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node1.Close()
+
+			// buffer events in order not to block channels while polling
+			events1 := make(chan Event, 1024)
+			go func() {
+				for evt := range node1.Events() {
+					select {
+					case events1 <- evt:
+					default:
+					}
+				}
+			}()
+
+			node2, err := NewNode(NodeConf{
+				D:               MustDialectCT(3, msgs),
+				OutVersion:      V2,
+				OutSystemId:     11,
+				Endpoints:       []EndpointConf{EndpointCustom{p2}, EndpointCustom{p4}},
+				HeartbeatPeriod: 50 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer node2.Close()
+
+			link := node1.Link("vehicle")
+			require.NotNil(t, link)
+			require.Equal(t, []*Link{link}, node1.Links())
+
+			received := make(chan *EventFrame, 10)
+			var remotePrimary *Channel
+			var remoteBackup *Channel
+			for remotePrimary == nil || remoteBackup == nil {
+				evt := (<-node2.Events()).(*EventChannelOpen)
+				if evt.Channel.Endpoint.Conf() == (EndpointCustom{p2}) {
+					remotePrimary = evt.Channel
+				} else {
+					remoteBackup = evt.Channel
+				}
+			}
+			go func() {
+				for evt := range node2.Events() {
+					if fr, ok := evt.(*EventFrame); ok {
+						received <- fr
+					}
+				}
+			}()
+
+			// wait until the primary channel is active
+			var primary *Channel
+			for primary == nil {
+				evt, ok := (<-events1).(*EventLinkChange)
+				if ok && evt.Channel.Endpoint.Conf() == (EndpointCustom{p1}) {
+					require.Equal(t, link, evt.Link)
+					primary = evt.Channel
+				}
+			}
+			require.Equal(t, primary, link.Channel())
+
+			// wait until both channels are part of the link
+			for len(link.Channels()) != 2 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			err = link.WriteMessage(&MessageSystemTime{TimeUnixUsec: 1})
+			require.NoError(t, err)
+
+			fr := <-received
+			require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, fr.Message())
+			if strategy == LinkBroadcast {
+				fr2 := <-received
+				require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, fr2.Message())
+				require.True(t, fr.Channel != fr2.Channel)
+			} else {
+				require.Equal(t, remotePrimary, fr.Channel)
+			}
+
+			// heartbeats received through both channels are emitted once
+			count := 0
+			for evt := range events1 {
+				if fr, ok := evt.(*EventFrame); ok && fr.Message().GetId() == 0 {
+					count++
+					if count == 5 {
+						break
+					}
+				}
+			}
+			suppressed := uint64(0)
+			for _, ch := range link.Channels() {
+				suppressed += ch.Stats().DuplicatesSuppressed
+			}
+			require.NotEqual(t, uint64(0), suppressed)
+
+			// node-level writes follow the strategy too. Routes are learned
+			// through both channels, even if frames are deduplicated.
+			node1.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 10})
+			node1.WriteMessageRouted(&MessageParamRequestRead{TargetSystem: 11, TargetComponent: 1})
+			node1.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 11})
+
+			var all []*Channel
+			var routed []*Channel
+			var last []*Channel
+			expected := 1
+			if strategy == LinkBroadcast {
+				expected = 2
+			}
+			for len(last) < expected {
+				fr := <-received
+				switch msg := fr.Message().(type) {
+				case *MessageSystemTime:
+					if msg.TimeUnixUsec == 10 {
+						all = append(all, fr.Channel)
+					} else if msg.TimeUnixUsec == 11 {
+						last = append(last, fr.Channel)
+					}
+
+				case *MessageParamRequestRead:
+					routed = append(routed, fr.Channel)
+				}
+			}
+			if strategy == LinkBroadcast {
+				require.Equal(t, 2, len(all))
+				require.Equal(t, 2, len(routed))
+			} else {
+				require.Equal(t, []*Channel{remotePrimary}, all)
+				require.Equal(t, []*Channel{remotePrimary}, routed)
+			}
+
+			// the primary channel is lost
+			err = node2.RemoveEndpoint(remotePrimary.Endpoint)
+			require.NoError(t, err)
+
+			for {
+				evt, ok := (<-events1).(*EventLinkChange)
+				if ok {
+					require.Equal(t, EndpointCustom{p3}, evt.Channel.Endpoint.Conf())
+					break
+				}
+			}
+			err = link.WriteMessage(&MessageSystemTime{TimeUnixUsec: 2})
+			require.NoError(t, err)
+
+			for {
+				fr := <-received
+				if fr.Message().GetId() == 2 {
+					require.Equal(t, &MessageSystemTime{TimeUnixUsec: 2}, fr.Message())
+					require.Equal(t, remoteBackup, fr.Channel)
+					break
+				}
+			}
+		})
+	}
+}
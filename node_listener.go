@@ -0,0 +1,170 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	_FRAME_LISTENER_BUFFER_SIZE = 64
+)
+
+// ErrRequestTimeout is returned when a request of a microservice client
+// is not answered by the target.
+var ErrRequestTimeout = fmt.Errorf("request timed out")
+
+// frameListener receives the incoming frames that satisfy a condition.
+// It is used by the microservice clients to wait for responses without
+// interfering with Events(). Frames are either sent to the frames channel
+// or passed to handler, that is called by the routine that reads the channel.
+type frameListener struct {
+	match   func(*EventFrame) bool
+	frames  chan *EventFrame
+	handler func(*EventFrame)
+	indexed bool
+	id      uint32
+}
+
+func (n *Node) addFrameListener(match func(*EventFrame) bool) *frameListener {
+	l := &frameListener{
+		match:  match,
+		frames: make(chan *EventFrame, _FRAME_LISTENER_BUFFER_SIZE),
+	}
+
+	n.listenersMutex.Lock()
+	defer n.listenersMutex.Unlock()
+	n.listeners[l] = struct{}{}
+
+	return l
+}
+
+func (n *Node) addFrameHandler(match func(*EventFrame) bool, handler func(*EventFrame)) *frameListener {
+	l := &frameListener{
+		match:   match,
+		handler: handler,
+	}
+
+	n.listenersMutex.Lock()
+	defer n.listenersMutex.Unlock()
+	n.listeners[l] = struct{}{}
+
+	return l
+}
+
+// addMessageHandler adds a handler that is called only for frames with the
+// given message id. Handlers are indexed by id, therefore frames with other ids
+// don't pay for them.
+func (n *Node) addMessageHandler(id uint32, match func(*EventFrame) bool, handler func(*EventFrame)) *frameListener {
+	l := &frameListener{
+		match:   match,
+		handler: handler,
+		indexed: true,
+		id:      id,
+	}
+
+	n.listenersMutex.Lock()
+	defer n.listenersMutex.Unlock()
+	if _, ok := n.handlers[id]; !ok {
+		n.handlers[id] = make(map[*frameListener]struct{})
+	}
+	n.handlers[id][l] = struct{}{}
+
+	return l
+}
+
+func (n *Node) removeFrameListener(l *frameListener) {
+	n.listenersMutex.Lock()
+	defer n.listenersMutex.Unlock()
+
+	if l.indexed {
+		delete(n.handlers[l.id], l)
+		if len(n.handlers[l.id]) == 0 {
+			delete(n.handlers, l.id)
+		}
+		return
+	}
+	delete(n.listeners, l)
+}
+
+func (n *Node) dispatchFrameListeners(evt *EventFrame) {
+	var matched []*frameListener
+	func() {
+		n.listenersMutex.Lock()
+		defer n.listenersMutex.Unlock()
+
+		for l := range n.handlers[evt.Message().GetId()] {
+			if l.match == nil || l.match(evt) {
+				matched = append(matched, l)
+			}
+		}
+
+		for l := range n.listeners {
+			if l.match(evt) {
+				matched = append(matched, l)
+			}
+		}
+	}()
+
+	// handlers are called before sending frames to listeners, in order to
+	// allow them to update the state read by listeners, and without holding
+	// the mutex, since they can emit events
+	for _, l := range matched {
+		if l.handler != nil {
+			l.handler(evt)
+		}
+	}
+
+	for _, l := range matched {
+		if l.handler != nil {
+			continue
+		}
+
+		// frames are discarded if the listener is too slow.
+		// This is acceptable since microservices retransmit lost messages.
+		select {
+		case l.frames <- evt:
+		default:
+		}
+	}
+}
+
+// request writes a message to the channels where its target has been seen and
+// waits for a frame accepted by handle, writing the message again in case of timeout.
+// handle returns true when the frame is the expected response, or an error
+// to abort the request. If msg is nil, the function just waits.
+func (n *Node) request(ctx context.Context, l *frameListener, msg Message,
+	timeout time.Duration, retries int, handle func(*EventFrame) (bool, error)) (*EventFrame, error) {
+	for attempt := 0; attempt <= retries; attempt++ {
+		if msg != nil {
+			n.WriteMessageRouted(msg)
+		}
+
+		timer := time.NewTimer(timeout)
+
+	wait:
+		for {
+			select {
+			case evt := <-l.frames:
+				ok, err := handle(evt)
+				if err != nil {
+					timer.Stop()
+					return nil, err
+				}
+				if ok {
+					timer.Stop()
+					return evt, nil
+				}
+
+			case <-timer.C:
+				break wait
+
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, ErrRequestTimeout
+}
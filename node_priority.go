@@ -0,0 +1,120 @@
+package gomavlib
+
+// prioritizedItem is a message or frame written with an explicit priority.
+type prioritizedItem struct {
+	what     interface{}
+	priority Priority
+}
+
+// default priorities of outgoing messages, indexed by message id.
+var defaultWritePriorities = map[uint32]Priority{
+	0:  PriorityHigh, // HEARTBEAT
+	75: PriorityHigh, // COMMAND_INT
+	76: PriorityHigh, // COMMAND_LONG
+	77: PriorityHigh, // COMMAND_ACK
+}
+
+// itemMessage returns the message contained in an outgoing item.
+func itemMessage(what interface{}) Message {
+	switch wh := what.(type) {
+	case Message:
+		return wh
+	case Frame:
+		return wh.GetMessage()
+	case *componentMessage:
+		return wh.message
+	case *prioritizedItem:
+		return itemMessage(wh.what)
+	}
+	return nil
+}
+
+// itemPriority unwraps an outgoing item and returns its priority.
+func (n *Node) itemPriority(what interface{}) (interface{}, Priority) {
+	if pi, ok := what.(*prioritizedItem); ok {
+		return pi.what, pi.priority
+	}
+
+	if msg := itemMessage(what); msg != nil {
+		if p, ok := n.conf.WritePriorities[msg.GetId()]; ok {
+			return what, p
+		}
+		if p, ok := defaultWritePriorities[msg.GetId()]; ok {
+			return what, p
+		}
+	}
+	return what, PriorityNormal
+}
+
+// WriteMessageToPriority writes a message to given channel, with the given
+// priority instead of the one of WritePriorities.
+func (n *Node) WriteMessageToPriority(channel *Channel, message Message, priority Priority) {
+	n.writeTo(channel, &prioritizedItem{message, priority})
+}
+
+// WriteMessageAllPriority writes a message to all channels, with the given
+// priority instead of the one of WritePriorities.
+func (n *Node) WriteMessageAllPriority(message Message, priority Priority) {
+	n.writeAll(&prioritizedItem{message, priority})
+}
+
+// WriteMessageExceptPriority writes a message to all channels except specified
+// channel, with the given priority instead of the one of WritePriorities.
+func (n *Node) WriteMessageExceptPriority(exceptChannel *Channel, message Message, priority Priority) {
+	n.writeExcept(exceptChannel, &prioritizedItem{message, priority})
+}
+
+// WriteMessageRoutedPriority writes a message to the channels where its target
+// has been seen, with the given priority instead of the one of WritePriorities.
+// See WriteMessageRouted().
+func (n *Node) WriteMessageRoutedPriority(message Message, priority Priority) {
+	n.writeRouted(nil, &prioritizedItem{message, priority})
+}
+
+// WriteFrameToPriority writes a frame to given channel, with the given
+// priority instead of the one of WritePriorities.
+func (n *Node) WriteFrameToPriority(channel *Channel, frame Frame, priority Priority) {
+	n.writeTo(channel, &prioritizedItem{frame, priority})
+}
+
+// WriteFrameAllPriority writes a frame to all channels, with the given
+// priority instead of the one of WritePriorities.
+func (n *Node) WriteFrameAllPriority(frame Frame, priority Priority) {
+	n.writeAll(&prioritizedItem{frame, priority})
+}
+
+// WriteFrameExceptPriority writes a frame to all channels except specified
+// channel, with the given priority instead of the one of WritePriorities.
+func (n *Node) WriteFrameExceptPriority(exceptChannel *Channel, frame Frame, priority Priority) {
+	n.writeExcept(exceptChannel, &prioritizedItem{frame, priority})
+}
+
+// WriteFrameRoutedPriority routes a frame like WriteFrameRouted(), with the
+// given priority instead of the one of WritePriorities.
+func (n *Node) WriteFrameRoutedPriority(sourceChannel *Channel, frame Frame, priority Priority) {
+	n.writeRouted(sourceChannel, &prioritizedItem{frame, priority})
+}
+
+// WriteMessageToPriority writes a message to given channel, with the given
+// priority instead of the one of WritePriorities.
+func (c *NodeComponent) WriteMessageToPriority(channel *Channel, message Message, priority Priority) {
+	c.n.writeTo(channel, &prioritizedItem{&componentMessage{c.componentId, message}, priority})
+}
+
+// WriteMessageAllPriority writes a message to all channels, with the given
+// priority instead of the one of WritePriorities.
+func (c *NodeComponent) WriteMessageAllPriority(message Message, priority Priority) {
+	c.n.writeAll(&prioritizedItem{&componentMessage{c.componentId, message}, priority})
+}
+
+// WriteMessageExceptPriority writes a message to all channels except specified
+// channel, with the given priority instead of the one of WritePriorities.
+func (c *NodeComponent) WriteMessageExceptPriority(exceptChannel *Channel, message Message, priority Priority) {
+	c.n.writeExcept(exceptChannel, &prioritizedItem{&componentMessage{c.componentId, message}, priority})
+}
+
+// WriteMessageRoutedPriority writes a message to the channels that lead to its
+// target, with the given priority instead of the one of WritePriorities.
+func (c *NodeComponent) WriteMessageRoutedPriority(message Message, priority Priority) {
+	c.n.writeRouted(nil, &prioritizedItem{&componentMessage{c.componentId, message}, priority})
+}
@@ -0,0 +1,152 @@
+package gomavlib
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RemoteSystem is a remote system or component detected through its heartbeats.
+type RemoteSystem struct {
+	// the channel from which the last heartbeat was received
+	Channel *Channel
+	// the system id
+	SystemId byte
+	// the component id
+	ComponentId byte
+	// the type of the system (MAV_TYPE)
+	Type uint8
+	// the autopilot type (MAV_AUTOPILOT)
+	Autopilot uint8
+	// the time of reception of the last heartbeat
+	LastSeen time.Time
+}
+
+type registryKey struct {
+	SystemId    byte
+	ComponentId byte
+}
+
+type nodeRegistry struct {
+	n         *Node
+	terminate chan struct{}
+	mutex     sync.Mutex
+	systems   map[registryKey]*RemoteSystem
+}
+
+func newNodeRegistry(n *Node) *nodeRegistry {
+	// heartbeat message must exist in dialect and correspond to standard
+	if dialectHasMessage(n.conf.D, 0, 50) == false {
+		return nil
+	}
+
+	r := &nodeRegistry{
+		n:         n,
+		terminate: make(chan struct{}, 1),
+		systems:   make(map[registryKey]*RemoteSystem),
+	}
+
+	return r
+}
+
+func (r *nodeRegistry) close() {
+	r.terminate <- struct{}{}
+}
+
+func (r *nodeRegistry) run() {
+	ticker := time.NewTicker(r.n.conf.HeartbeatTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			var lost []*RemoteSystem
+
+			func() {
+				r.mutex.Lock()
+				defer r.mutex.Unlock()
+
+				for key, sys := range r.systems {
+					if now.Sub(sys.LastSeen) >= r.n.conf.HeartbeatTimeout {
+						delete(r.systems, key)
+						lost = append(lost, sys)
+					}
+				}
+			}()
+
+			for _, sys := range lost {
+				r.n.emitEvent(&EventSystemLost{
+					Channel:     sys.Channel,
+					SystemId:    sys.SystemId,
+					ComponentId: sys.ComponentId,
+				})
+			}
+
+		case <-r.terminate:
+			return
+		}
+	}
+}
+
+func (r *nodeRegistry) onEventFrame(evt *EventFrame) {
+	if evt.Message().GetId() != 0 {
+		return
+	}
+
+	typ, _ := messageFieldUint(evt.Message(), "type")
+	autopilot, _ := messageFieldUint(evt.Message(), "autopilot")
+
+	key := registryKey{evt.SystemId(), evt.ComponentId()}
+	now := time.Now()
+
+	appeared := false
+	func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		sys, ok := r.systems[key]
+		if !ok {
+			sys = &RemoteSystem{
+				SystemId:    evt.SystemId(),
+				ComponentId: evt.ComponentId(),
+			}
+			r.systems[key] = sys
+			appeared = true
+		}
+
+		sys.Channel = evt.Channel
+		sys.Type = uint8(typ)
+		sys.Autopilot = uint8(autopilot)
+		sys.LastSeen = now
+	}()
+
+	if appeared {
+		r.n.emitEvent(&EventSystemAppeared{
+			Channel:     evt.Channel,
+			SystemId:    evt.SystemId(),
+			ComponentId: evt.ComponentId(),
+			Type:        uint8(typ),
+			Autopilot:   uint8(autopilot),
+		})
+	}
+}
+
+func (r *nodeRegistry) list() []*RemoteSystem {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := make([]*RemoteSystem, 0, len(r.systems))
+	for _, sys := range r.systems {
+		cpy := *sys
+		ret = append(ret, &cpy)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].SystemId != ret[j].SystemId {
+			return ret[i].SystemId < ret[j].SystemId
+		}
+		return ret[i].ComponentId < ret[j].ComponentId
+	})
+
+	return ret
+}
@@ -0,0 +1,121 @@
+package gomavlib
+
+import (
+	"sync"
+)
+
+type routeKey struct {
+	SystemId    byte
+	ComponentId byte
+}
+
+// nodeRouter learns which systems and components are reachable through
+// each channel, and uses this knowledge to route frames that have a target,
+// as described in https://mavlink.io/en/guide/routing.html
+type nodeRouter struct {
+	n           *Node
+	routesMutex sync.Mutex
+	routes      map[routeKey]map[*Channel]struct{}
+}
+
+func newNodeRouter(n *Node) *nodeRouter {
+	r := &nodeRouter{
+		n:      n,
+		routes: make(map[routeKey]map[*Channel]struct{}),
+	}
+
+	return r
+}
+
+func (r *nodeRouter) onEventFrame(evt *EventFrame) {
+	// system id 0 is reserved for broadcast
+	if evt.SystemId() == 0 {
+		return
+	}
+
+	key := routeKey{evt.SystemId(), evt.ComponentId()}
+
+	r.routesMutex.Lock()
+	defer r.routesMutex.Unlock()
+
+	if _, ok := r.routes[key]; !ok {
+		r.routes[key] = make(map[*Channel]struct{})
+	}
+	r.routes[key][evt.Channel] = struct{}{}
+}
+
+func (r *nodeRouter) onChannelClose(ch *Channel) {
+	r.routesMutex.Lock()
+	defer r.routesMutex.Unlock()
+
+	for key, chans := range r.routes {
+		delete(chans, ch)
+		if len(chans) == 0 {
+			delete(r.routes, key)
+		}
+	}
+}
+
+// route returns the channels to which a message must be written.
+// Messages without a target, broadcast messages, messages addressed to
+// an unknown target and messages that have not been decoded are written
+// to every channel except the source channel.
+func (r *nodeRouter) route(msg Message, except *Channel) []*Channel {
+	all := func() []*Channel {
+		var ret []*Channel
+		for ch := range r.n.channels {
+			if ch != except {
+				ret = append(ret, ch)
+			}
+		}
+		return ret
+	}
+
+	targetSystem, ok := messageFieldUint(msg, "target_system")
+	if ok == false || targetSystem == 0 {
+		return all()
+	}
+
+	targetComponent, _ := messageFieldUint(msg, "target_component")
+
+	r.routesMutex.Lock()
+	defer r.routesMutex.Unlock()
+
+	found := make(map[*Channel]struct{})
+
+	// target component is known
+	if targetComponent != 0 {
+		for ch := range r.routes[routeKey{byte(targetSystem), byte(targetComponent)}] {
+			found[ch] = struct{}{}
+		}
+	}
+
+	// target component is not specified or not known, route the message
+	// to every channel where the target system has been seen
+	if len(found) == 0 {
+		for key, chans := range r.routes {
+			if key.SystemId == byte(targetSystem) {
+				for ch := range chans {
+					found[ch] = struct{}{}
+				}
+			}
+		}
+	}
+
+	// target system is not known
+	if len(found) == 0 {
+		return all()
+	}
+
+	var ret []*Channel
+	for ch := range found {
+		// channel may have been closed in the meanwhile
+		if _, ok := r.n.channels[ch]; !ok {
+			continue
+		}
+		if ch != except {
+			ret = append(ret, ch)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,51 @@
+package gomavlib
+
+import (
+	"time"
+)
+
+type nodeStats struct {
+	n         *Node
+	terminate chan struct{}
+}
+
+func newNodeStats(n *Node) *nodeStats {
+	return &nodeStats{
+		n:         n,
+		terminate: make(chan struct{}, 1),
+	}
+}
+
+func (s *nodeStats) close() {
+	s.terminate <- struct{}{}
+}
+
+func (s *nodeStats) run() {
+	ticker := time.NewTicker(s.n.conf.StatsPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			res := make(chan []*Channel, 1)
+			s.n.eventsIn <- &eventInChannels{res}
+			channels := <-res
+
+			for _, ch := range channels {
+				ch.stats.update(now)
+			}
+
+			if s.n.conf.StatsEventEnable {
+				for _, ch := range channels {
+					s.n.emitEvent(&EventChannelStats{
+						Channel: ch,
+						Stats:   ch.Stats(),
+					})
+				}
+			}
+
+		case <-s.terminate:
+			return
+		}
+	}
+}
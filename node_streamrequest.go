@@ -1,13 +1,37 @@
 package gomavlib
 
 import (
+	"context"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 )
 
 const (
 	_STREAM_REQUEST_PERIOD = 30 * time.Second
+
+	_MAV_AUTOPILOT_GENERIC        = 0
+	_MAV_AUTOPILOT_INVALID        = 8
+	_MAV_TYPE_GCS                 = 6
+	_MAV_TYPE_ONBOARD_CONTROLLER  = 18
+	_MAV_CMD_SET_MESSAGE_INTERVAL = 511
+)
+
+// StreamRequestMode is the method used to request telemetry streams.
+type StreamRequestMode int
+
+const (
+	// StreamRequestDataStream requests the legacy stream groups with
+	// REQUEST_DATA_STREAM, at StreamRequestFrequency. It is supported by
+	// Ardupilot only.
+	StreamRequestDataStream StreamRequestMode = iota
+	// StreamRequestMessageInterval requests each message of StreamRequestMessages
+	// with MAV_CMD_SET_MESSAGE_INTERVAL, that must be acknowledged by the target.
+	// Requests are sent to flight controllers only, i.e. components whose heartbeat
+	// reports a known autopilot and a type other than GCS or onboard controller.
+	// It is supported by Ardupilot and PX4.
+	StreamRequestMessageInterval
 )
 
 type streamNode struct {
@@ -21,6 +45,11 @@ type nodeStreamRequest struct {
 	terminate         chan struct{}
 	lastRequestsMutex sync.Mutex
 	lastRequests      map[streamNode]time.Time
+	pending           map[streamNode]struct{}
+	closed            bool
+	ctx               context.Context
+	ctxCancel         func()
+	wg                sync.WaitGroup
 }
 
 func newNodeStreamRequest(n *Node) *nodeStreamRequest {
@@ -40,16 +69,29 @@ func newNodeStreamRequest(n *Node) *nodeStreamRequest {
 		return nil
 	}
 
-	// request data stream message must exist in dialect and correspond to standard
-	mp, ok = n.conf.D.getMsgById(66)
-	if ok == false || (*mp).getCRCExtra() != 148 {
-		return nil
+	if n.conf.StreamRequestMode == StreamRequestMessageInterval {
+		// command messages must exist in dialect and correspond to standard
+		if dialectHasMessage(n.conf.D, 76, 152) == false || // COMMAND_LONG
+			dialectHasMessage(n.conf.D, 77, 143) == false { // COMMAND_ACK
+			return nil
+		}
+	} else {
+		// request data stream message must exist in dialect and correspond to standard
+		mp, ok = n.conf.D.getMsgById(66)
+		if ok == false || (*mp).getCRCExtra() != 148 {
+			return nil
+		}
 	}
 
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
 	sr := &nodeStreamRequest{
 		n:            n,
 		terminate:    make(chan struct{}),
 		lastRequests: make(map[streamNode]time.Time),
+		pending:      make(map[streamNode]struct{}),
+		ctx:          ctx,
+		ctxCancel:    ctxCancel,
 	}
 
 	return sr
@@ -57,6 +99,16 @@ func newNodeStreamRequest(n *Node) *nodeStreamRequest {
 
 func (sr *nodeStreamRequest) close() {
 	sr.terminate <- struct{}{}
+
+	// channels are still open and may receive heartbeats, that must not
+	// start other requests
+	sr.lastRequestsMutex.Lock()
+	sr.closed = true
+	sr.lastRequestsMutex.Unlock()
+
+	// stop pending message interval requests
+	sr.ctxCancel()
+	sr.wg.Wait()
 }
 
 func (sr *nodeStreamRequest) run() {
@@ -85,6 +137,11 @@ func (sr *nodeStreamRequest) run() {
 }
 
 func (sr *nodeStreamRequest) onEventFrame(evt *EventFrame) {
+	if sr.n.conf.StreamRequestMode == StreamRequestMessageInterval {
+		sr.onEventFrameMessageInterval(evt)
+		return
+	}
+
 	// message must be heartbeat and sender must be an ardupilot device
 	dynamicMessageFound := false
 	if msg, ok := evt.Message().(*DynamicMessage); ok {
@@ -160,11 +217,11 @@ func (sr *nodeStreamRequest) onEventFrame(evt *EventFrame) {
 				sr.n.WriteMessageTo(evt.Channel, msg)
 			}
 
-			sr.n.eventsOut <- &EventStreamRequested{
+			sr.n.emitEvent(&EventStreamRequested{
 				Channel:     evt.Channel,
 				SystemId:    evt.SystemId(),
 				ComponentId: evt.ComponentId(),
-			}
+			})
 		}
 	} else {
 		if request == true {
@@ -190,12 +247,109 @@ func (sr *nodeStreamRequest) onEventFrame(evt *EventFrame) {
 				sr.n.WriteMessageTo(evt.Channel, msg)
 			}
 
-			sr.n.eventsOut <- &EventStreamRequested{
+			sr.n.emitEvent(&EventStreamRequested{
 				Channel:     evt.Channel,
 				SystemId:    evt.SystemId(),
 				ComponentId: evt.ComponentId(),
+			})
+		}
+	}
+
+}
+
+func (sr *nodeStreamRequest) onEventFrameMessageInterval(evt *EventFrame) {
+	// message must be heartbeat and sender must be a flight controller
+	if evt.Message().GetId() != 0 || isAutopilotHeartbeat(evt.Message()) == false {
+		return
+	}
+
+	rnode := streamNode{
+		Channel:     evt.Channel,
+		SystemId:    evt.SystemId(),
+		ComponentId: evt.ComponentId(),
+	}
+
+	// request messages if sender is new or a request has not been sent in some time,
+	// unless a request is still in progress
+	sr.lastRequestsMutex.Lock()
+	defer sr.lastRequestsMutex.Unlock()
+
+	if sr.closed {
+		return
+	}
+
+	now := time.Now()
+	if t, ok := sr.lastRequests[rnode]; ok && now.Sub(t) < _STREAM_REQUEST_PERIOD {
+		return
+	}
+	if _, ok := sr.pending[rnode]; ok {
+		return
+	}
+	sr.lastRequests[rnode] = now
+	sr.pending[rnode] = struct{}{}
+
+	// commands can't be sent by this routine, since acks are received by it
+	sr.wg.Add(1)
+	go sr.requestMessageIntervals(rnode)
+}
+
+func (sr *nodeStreamRequest) requestMessageIntervals(rnode streamNode) {
+	defer sr.wg.Done()
+	defer func() {
+		sr.lastRequestsMutex.Lock()
+		defer sr.lastRequestsMutex.Unlock()
+		delete(sr.pending, rnode)
+	}()
+
+	ids := make([]uint32, 0, len(sr.n.conf.StreamRequestMessages))
+	for id := range sr.n.conf.StreamRequestMessages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	target := CommandTarget{rnode.SystemId, rnode.ComponentId}
+	var rejected []uint32
+
+	for _, id := range ids {
+		// an interval of -1 disables the message
+		interval := float32(-1)
+		if rate := sr.n.conf.StreamRequestMessages[id]; rate > 0 {
+			interval = float32(1000000 / rate)
+		}
+
+		// the command is sent through the channel of the target, that is also
+		// the channel from which the ack is expected
+		_, err := sr.n.sendCommandLong(sr.ctx, rnode.Channel, target, _MAV_CMD_SET_MESSAGE_INTERVAL,
+			[7]float32{float32(id), interval})
+		if err != nil {
+			if sr.ctx.Err() != nil {
+				return
 			}
+			rejected = append(rejected, id)
 		}
 	}
 
+	sr.n.emitEvent(&EventStreamRequested{
+		Channel:     rnode.Channel,
+		SystemId:    rnode.SystemId,
+		ComponentId: rnode.ComponentId,
+		Rejected:    rejected,
+	})
+}
+
+// isAutopilotHeartbeat checks whether a heartbeat has been sent by a flight
+// controller. Ground stations, companion computers and components that report
+// a generic or invalid autopilot are excluded.
+func isAutopilotHeartbeat(msg Message) bool {
+	typ, ok := messageFieldUint(msg, "type")
+	if ok == false || typ == _MAV_TYPE_GCS || typ == _MAV_TYPE_ONBOARD_CONTROLLER {
+		return false
+	}
+	autopilot, ok := messageFieldUint(msg, "autopilot")
+	if ok == false || autopilot == _MAV_AUTOPILOT_GENERIC || autopilot == _MAV_AUTOPILOT_INVALID {
+		return false
+	}
+	return true
 }
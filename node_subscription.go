@@ -0,0 +1,309 @@
+package gomavlib
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// SubscriptionPolicy is the policy applied when the buffer of a subscription is full.
+type SubscriptionPolicy int
+
+const (
+	// SubscriptionDropOldest discards the oldest buffered event in order to make
+	// space for the new one.
+	SubscriptionDropOldest SubscriptionPolicy = iota
+	// SubscriptionDropNewest discards the new event.
+	SubscriptionDropNewest
+	// SubscriptionBlock waits until there's space in the buffer.
+	// While waiting, the routines that produce events are blocked, therefore
+	// this policy should be used only by consumers that are always fast.
+	SubscriptionBlock
+)
+
+// SubscriptionFilter selects the events received by a subscription.
+// Each non-empty field restricts the events that are received: events that
+// do not contain the filtered property are discarded.
+type SubscriptionFilter struct {
+	// (optional) the event types, i.e. (*EventFrame)(nil)
+	Types []Event
+	// (optional) the ids of the messages contained in EventFrame
+	MessageIds []uint32
+	// (optional) the system ids of the remote systems
+	SystemIds []byte
+	// (optional) the component ids of the remote systems
+	ComponentIds []byte
+	// (optional) the channels
+	Channels []*Channel
+}
+
+// SubscriptionConf allows to configure a Subscription.
+type SubscriptionConf struct {
+	// (optional) the filter applied to events.
+	Filter SubscriptionFilter
+	// (optional) the number of events that can be buffered. It defaults to 64.
+	BufferSize int
+	// (optional) the policy applied when the buffer is full.
+	// See SubscriptionPolicy for the available options.
+	// It defaults to SubscriptionDropOldest.
+	Policy SubscriptionPolicy
+}
+
+// Subscription is an independent stream of events of a Node.
+type Subscription struct {
+	n       *Node
+	conf    SubscriptionConf
+	events  chan Event
+	done    chan struct{}
+	dropped uint64
+
+	doneOnce sync.Once
+
+	// held while writing into events
+	mutex  sync.Mutex
+	closed bool
+}
+
+// Subscribe allocates a Subscription, that receives the events of the node
+// that match the filter, independently from Events() and other subscriptions.
+// See SubscriptionConf for the options.
+func (n *Node) Subscribe(conf SubscriptionConf) *Subscription {
+	if conf.BufferSize == 0 {
+		conf.BufferSize = 64
+	}
+
+	s := &Subscription{
+		n:      n,
+		conf:   conf,
+		events: make(chan Event, conf.BufferSize),
+		done:   make(chan struct{}),
+	}
+
+	n.subscriptionsMutex.Lock()
+	defer n.subscriptionsMutex.Unlock()
+	n.subscriptions[s] = struct{}{}
+
+	return s
+}
+
+// Events returns the channel from which receiving events.
+// The channel is closed when the subscription is removed or the node is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events that have been discarded because the
+// buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe removes the subscription and closes its channel.
+func (s *Subscription) Unsubscribe() {
+	func() {
+		s.n.subscriptionsMutex.Lock()
+		defer s.n.subscriptionsMutex.Unlock()
+		delete(s.n.subscriptions, s)
+	}()
+
+	s.close()
+}
+
+func (s *Subscription) close() {
+	// unblock writers
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+}
+
+func (s *Subscription) push(evt Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	switch s.conf.Policy {
+	case SubscriptionBlock:
+		select {
+		case s.events <- evt:
+		case <-s.done:
+		}
+
+	case SubscriptionDropNewest:
+		select {
+		case s.events <- evt:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+
+	default:
+		for {
+			select {
+			case s.events <- evt:
+				return
+			default:
+			}
+
+			select {
+			case <-s.events:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	}
+}
+
+// eventSource returns the channel, system id and component id associated
+// with an event, if present.
+func eventSource(evt Event) (*Channel, bool, byte, byte, bool) {
+	if e, ok := evt.(*EventFrame); ok {
+		return e.Channel, true, e.SystemId(), e.ComponentId(), true
+	}
+
+	rv := reflect.ValueOf(evt).Elem()
+
+	var ch *Channel
+	hasChannel := false
+	if f := rv.FieldByName("Channel"); f.IsValid() {
+		ch, hasChannel = f.Interface().(*Channel)
+	}
+
+	sf := rv.FieldByName("SystemId")
+	cf := rv.FieldByName("ComponentId")
+	if sf.IsValid() && cf.IsValid() {
+		return ch, hasChannel, byte(sf.Uint()), byte(cf.Uint()), true
+	}
+	return ch, hasChannel, 0, 0, false
+}
+
+func (f *SubscriptionFilter) match(evt Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if reflect.TypeOf(t) == reflect.TypeOf(evt) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.MessageIds) > 0 {
+		e, ok := evt.(*EventFrame)
+		if !ok {
+			return false
+		}
+		found := false
+		for _, id := range f.MessageIds {
+			if e.Message().GetId() == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Channels) == 0 && len(f.SystemIds) == 0 && len(f.ComponentIds) == 0 {
+		return true
+	}
+
+	ch, hasChannel, systemId, componentId, hasSource := eventSource(evt)
+
+	if len(f.Channels) > 0 {
+		if !hasChannel {
+			return false
+		}
+		found := false
+		for _, c := range f.Channels {
+			if c == ch {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.SystemIds) > 0 {
+		if !hasSource {
+			return false
+		}
+		found := false
+		for _, id := range f.SystemIds {
+			if id == systemId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.ComponentIds) > 0 {
+		if !hasSource {
+			return false
+		}
+		found := false
+		for _, id := range f.ComponentIds {
+			if id == componentId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// emitEvent delivers an event to the subscriptions and to Events().
+func (n *Node) emitEvent(evt Event) {
+	var subs []*Subscription
+	func() {
+		n.subscriptionsMutex.Lock()
+		defer n.subscriptionsMutex.Unlock()
+
+		for s := range n.subscriptions {
+			if s.conf.Filter.match(evt) {
+				subs = append(subs, s)
+			}
+		}
+	}()
+
+	for _, s := range subs {
+		s.push(evt)
+	}
+
+	if n.conf.EventsDisable == false {
+		n.eventsOut <- evt
+	}
+}
+
+func (n *Node) closeSubscriptions() {
+	n.subscriptionsMutex.Lock()
+	defer n.subscriptionsMutex.Unlock()
+
+	for s := range n.subscriptions {
+		delete(n.subscriptions, s)
+		s.close()
+	}
+}
@@ -0,0 +1,113 @@
+package gomavlib
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeSubscribe(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageSystemTime{}}
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		EventsDisable:    true,
+	})
+	require.NoError(t, err)
+
+	all := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			Types: []Event{(*EventFrame)(nil)},
+		},
+		Policy: SubscriptionBlock,
+	})
+	open := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			Types: []Event{(*EventChannelOpen)(nil)},
+		},
+	})
+	times := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			MessageIds: []uint32{2},
+			SystemIds:  []byte{11},
+		},
+	})
+	newest := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			MessageIds:   []uint32{0},
+			ComponentIds: []byte{1},
+		},
+		BufferSize: 1,
+		Policy:     SubscriptionDropNewest,
+	})
+	oldest := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			MessageIds: []uint32{0},
+		},
+		BufferSize: 1,
+	})
+	other := node1.Subscribe(SubscriptionConf{
+		Filter: SubscriptionFilter{
+			SystemIds: []byte{12},
+		},
+	})
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+	go func() {
+		for range node2.Events() {
+		}
+	}()
+
+	evt := <-open.Events()
+	ch := evt.(*EventChannelOpen).Channel
+	open.Unsubscribe()
+	_, ok := <-open.Events()
+	require.Equal(t, false, ok)
+
+	node2.WriteMessageAll(&MessageHeartbeat{CustomMode: 1})
+	node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 1})
+	node2.WriteMessageAll(&MessageHeartbeat{CustomMode: 2})
+	node2.WriteMessageAll(&MessageHeartbeat{CustomMode: 3})
+	node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 2})
+
+	// events are delivered to subscriptions in order, therefore when
+	// the last one is received all the others have been delivered
+	evt = <-times.Events()
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, evt.(*EventFrame).Message())
+	evt = <-times.Events()
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 2}, evt.(*EventFrame).Message())
+
+	for i := 0; i < 5; i++ {
+		evt := <-all.Events()
+		require.Equal(t, ch, evt.(*EventFrame).Channel)
+	}
+
+	evt = <-newest.Events()
+	require.Equal(t, &MessageHeartbeat{CustomMode: 1}, evt.(*EventFrame).Message())
+	require.Equal(t, uint64(2), newest.Dropped())
+
+	evt = <-oldest.Events()
+	require.Equal(t, &MessageHeartbeat{CustomMode: 3}, evt.(*EventFrame).Message())
+	require.Equal(t, uint64(2), oldest.Dropped())
+
+	require.Equal(t, 0, len(other.Events()))
+
+	node1.Close()
+	_, ok = <-all.Events()
+	require.Equal(t, false, ok)
+	all.Unsubscribe()
+}
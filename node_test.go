@@ -2,7 +2,9 @@ package gomavlib
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"net"
 	"reflect"
 	"sync"
 	"testing"
@@ -308,6 +310,175 @@ func TestNodeWriteMultipleInLoop(t *testing.T) {
 	}
 }
 
+type testStalledWriter struct {
+	io.ReadCloser
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *testStalledWriter) Write(buf []byte) (int, error) {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return len(buf), nil
+}
+
+func TestNodeWriteQueueDrop(t *testing.T) {
+	stalled := &testStalledWriter{make(testLoopback), make(chan struct{}, 1), make(chan struct{})}
+	l1 := make(testLoopback, 1000)
+
+	node, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{
+			EndpointCustom{stalled},
+			EndpointCustom{&testEndpoint{make(testLoopback), l1}},
+		},
+		HeartbeatDisable: true,
+		WriteQueueSize:   10,
+		WriteQueuePolicy: WriteQueueDropNewest,
+	})
+	require.NoError(t, err)
+
+	var stalledCh *Channel
+	var healthyCh *Channel
+	for evt := range node.Events() {
+		if e, ok := evt.(*EventChannelOpen); ok {
+			if _, ok := e.Channel.Endpoint.Conf().(EndpointCustom).ReadWriteCloser.(*testStalledWriter); ok {
+				stalledCh = e.Channel
+			} else {
+				healthyCh = e.Channel
+			}
+			if stalledCh != nil && healthyCh != nil {
+				break
+			}
+		}
+	}
+
+	// wait until the stalled channel is stuck in a write
+	node.WriteMessageTo(stalledCh, &MessageHeartbeat{})
+	<-stalled.writing
+
+	// writes must not block even if a channel is stalled
+	for i := 0; i < 100; i++ {
+		node.WriteMessageAll(&MessageHeartbeat{})
+	}
+
+	received := uint64(0)
+	for received+healthyCh.DroppedFrames() < 100 {
+		select {
+		case <-l1:
+			received++
+		case <-time.After(2 * time.Second):
+			t.Fatal("frames not received")
+		}
+	}
+	require.NotEqual(t, uint64(0), received)
+
+	require.Equal(t, ErrWriteQueueFull, node.TryWriteMessageTo(stalledCh, &MessageHeartbeat{}))
+	require.Equal(t, uint64(90), stalledCh.DroppedFrames())
+
+	close(stalled.release)
+	node.Close()
+}
+
+func TestNodeTryWriteClosedChannel(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	node, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node.Close()
+
+	ch := (<-node.Events()).(*EventChannelOpen).Channel
+
+	p2.Close()
+	require.Equal(t, &EventChannelClose{ch}, <-node.Events())
+
+	require.Equal(t, ErrChannelClosed, node.TryWriteMessageTo(ch, &MessageHeartbeat{}))
+}
+
+func TestNodeWriteQueueBlock(t *testing.T) {
+	stalled := &testStalledWriter{make(testLoopback), make(chan struct{}, 1), make(chan struct{})}
+	l1 := make(testLoopback, 1000)
+
+	node, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{
+			EndpointCustom{stalled},
+			EndpointCustom{&testEndpoint{make(testLoopback), l1}},
+		},
+		HeartbeatDisable: true,
+		WriteQueueSize:   10,
+		WriteQueuePolicy: WriteQueueBlock,
+	})
+	require.NoError(t, err)
+
+	var stalledCh *Channel
+	var healthyCh *Channel
+	for evt := range node.Events() {
+		if e, ok := evt.(*EventChannelOpen); ok {
+			if _, ok := e.Channel.Endpoint.Conf().(EndpointCustom).ReadWriteCloser.(*testStalledWriter); ok {
+				stalledCh = e.Channel
+			} else {
+				healthyCh = e.Channel
+			}
+			if stalledCh != nil && healthyCh != nil {
+				break
+			}
+		}
+	}
+
+	node.WriteMessageTo(stalledCh, &MessageHeartbeat{})
+	<-stalled.writing
+
+	// the routine that writes to the stalled channel waits
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			node.WriteMessageAll(&MessageHeartbeat{})
+		}
+	}()
+
+	// while the other channels keep working. The writer stops after filling
+	// the queue of the stalled channel.
+	for i := 0; i < 11; i++ {
+		select {
+		case <-l1:
+		case <-time.After(2 * time.Second):
+			t.Fatal("frames not received")
+		}
+	}
+	node.WriteMessageTo(healthyCh, &MessageHeartbeat{})
+	select {
+	case <-l1:
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame not received")
+	}
+
+	select {
+	case <-done:
+		t.Fatal("writer did not wait")
+	default:
+	}
+
+	close(stalled.release)
+	<-done
+	require.Equal(t, uint64(0), stalledCh.DroppedFrames())
+	node.Close()
+}
+
 func TestNodeSignature(t *testing.T) {
 	key1 := NewKey(bytes.Repeat([]byte("\x4F"), 32))
 	key2 := NewKey(bytes.Repeat([]byte("\xA8"), 32))
@@ -472,6 +643,192 @@ func TestNodeRouting(t *testing.T) {
 	require.Equal(t, true, success)
 }
 
+func TestNodeRoutingTarget(t *testing.T) {
+	dialect := MustDialectCT(3, []Message{&MessageHeartbeat{}, &MessageCommandLong{}})
+
+	newNode := func(systemId byte, rwcs ...io.ReadWriteCloser) (*Node, chan *EventFrame) {
+		var endpoints []EndpointConf
+		for _, rwc := range rwcs {
+			endpoints = append(endpoints, EndpointCustom{rwc})
+		}
+		node, err := NewNode(NodeConf{
+			D:                dialect,
+			OutVersion:       V2,
+			OutSystemId:      systemId,
+			Endpoints:        endpoints,
+			HeartbeatDisable: true,
+		})
+		require.NoError(t, err)
+
+		frames := make(chan *EventFrame, 100)
+		go func() {
+			for evt := range node.Events() {
+				if frm, ok := evt.(*EventFrame); ok {
+					frames <- frm
+				}
+			}
+		}()
+		return node, frames
+	}
+
+	ra, a := net.Pipe()
+	rb, b := net.Pipe()
+	rc, c := net.Pipe()
+
+	router, routerFrames := newNode(10, ra, rb, rc)
+	defer router.Close()
+	nodeA, framesA := newNode(1, a)
+	defer nodeA.Close()
+	nodeB, framesB := newNode(2, b)
+	defer nodeB.Close()
+	nodeC, framesC := newNode(3, c)
+	defer nodeC.Close()
+
+	go func() {
+		for frm := range routerFrames {
+			router.WriteFrameRouted(frm.Channel, frm.Frame)
+		}
+	}()
+
+	nodeB.WriteMessageAll(&MessageHeartbeat{})
+	nodeC.WriteMessageAll(&MessageHeartbeat{})
+
+	// wait until A receives heartbeats from both B and C,
+	// in such way that the router knows where they are
+	seen := make(map[byte]struct{})
+	for len(seen) < 2 {
+		select {
+		case frm := <-framesA:
+			seen[frm.SystemId()] = struct{}{}
+		case <-time.After(2 * time.Second):
+			t.Fatal("heartbeats not received")
+		}
+	}
+
+	nodeA.WriteMessageAll(&MessageCommandLong{TargetSystem: 2, TargetComponent: 1})
+	nodeA.WriteMessageAll(&MessageHeartbeat{})
+
+	type received struct {
+		systemId  byte
+		messageId uint32
+	}
+
+	receive := func(frames chan *EventFrame, count int) map[received]struct{} {
+		ret := make(map[received]struct{})
+		for i := 0; i < count; i++ {
+			select {
+			case frm := <-frames:
+				ret[received{frm.SystemId(), frm.Message().GetId()}] = struct{}{}
+			case <-time.After(2 * time.Second):
+				t.Fatal("frames not received")
+			}
+		}
+		return ret
+	}
+
+	// B receives C's heartbeat, the command and A's heartbeat,
+	// in an order that depends on scheduling
+	require.Equal(t, map[received]struct{}{
+		{3, 0}:  {},
+		{1, 76}: {},
+		{1, 0}:  {},
+	}, receive(framesB, 3))
+
+	// C receives B's heartbeat and A's heartbeat, but not the command,
+	// that is written by the router before A's heartbeat
+	require.Equal(t, map[received]struct{}{
+		{2, 0}: {},
+		{1, 0}: {},
+	}, receive(framesC, 2))
+}
+
+func TestNodeCommand(t *testing.T) {
+	dialect := MustDialectCT(3, []Message{&MessageHeartbeat{}, &MessageCommandLong{}, &MessageCommandAck{}})
+
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                dialect,
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		CommandTimeout:   200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                dialect,
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+
+	// node2 ignores the first transmission of each command, then
+	// reports progress and accepts the takeoff and rejects everything else
+	go func() {
+		for evt := range node2.Events() {
+			if e, ok := evt.(*EventFrame); ok {
+				if msg, ok := e.Message().(*MessageCommandLong); ok && msg.Confirmation == 1 {
+					if msg.Command == MAV_CMD_NAV_TAKEOFF {
+						node2.WriteMessageTo(e.Channel, &MessageCommandAck{
+							Command:  msg.Command,
+							Result:   MAV_RESULT_IN_PROGRESS,
+							Progress: 50,
+						})
+						node2.WriteMessageTo(e.Channel, &MessageCommandAck{
+							Command: msg.Command,
+							Result:  MAV_RESULT_ACCEPTED,
+						})
+					} else {
+						node2.WriteMessageTo(e.Channel, &MessageCommandAck{
+							Command: msg.Command,
+							Result:  MAV_RESULT_FAILED,
+						})
+					}
+				}
+			}
+		}
+	}()
+
+	progress := make(chan *EventCommandProgress, 10)
+	go func() {
+		for evt := range node1.Events() {
+			if e, ok := evt.(*EventCommandProgress); ok {
+				progress <- e
+			}
+		}
+	}()
+
+	res, err := node1.SendCommandLong(context.Background(), CommandTarget{11, 1},
+		uint16(MAV_CMD_NAV_TAKEOFF), [7]float32{0, 0, 0, 0, 0, 0, 10})
+	require.NoError(t, err)
+	require.Equal(t, int(MAV_RESULT_ACCEPTED), res.Result)
+	require.Equal(t, byte(11), res.SystemId)
+
+	prog := <-progress
+	require.Equal(t, uint16(MAV_CMD_NAV_TAKEOFF), prog.Command)
+	require.Equal(t, uint8(50), prog.Progress)
+
+	_, err = node1.SendCommandLong(context.Background(), CommandTarget{11, 1},
+		uint16(MAV_CMD_COMPONENT_ARM_DISARM), [7]float32{1})
+	require.Equal(t, &CommandError{uint16(MAV_CMD_COMPONENT_ARM_DISARM), int(MAV_RESULT_FAILED)}, err)
+
+	_, err = node1.SendCommandLong(context.Background(), CommandTarget{12, 1},
+		uint16(MAV_CMD_COMPONENT_ARM_DISARM), [7]float32{1})
+	require.Equal(t, ErrCommandTimeout, err)
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	ctxCancel()
+	_, err = node1.SendCommandLong(ctx, CommandTarget{11, 1},
+		uint16(MAV_CMD_COMPONENT_ARM_DISARM), [7]float32{1})
+	require.Equal(t, context.Canceled, err)
+}
+
 func TestNodeHeartbeat(t *testing.T) {
 	success := false
 
@@ -514,6 +871,288 @@ func TestNodeHeartbeat(t *testing.T) {
 	require.Equal(t, true, success)
 }
 
+func TestNodeHeartbeatState(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, []Message{&MessageHeartbeat{}})},
+		{"dynamic", testDialectRT(t, &MessageHeartbeat{})},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			node1, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+				OutVersion:       V2,
+				OutSystemId:      10,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer node1.Close()
+
+			node2, err := NewNode(NodeConf{
+				D:                      ca.d,
+				OutVersion:             V2,
+				OutSystemId:            11,
+				Endpoints:              []EndpointConf{EndpointCustom{p2}},
+				HeartbeatPeriod:        50 * time.Millisecond,
+				HeartbeatSystemType:    18, // MAV_TYPE_ONBOARD_CONTROLLER
+				HeartbeatAutopilotType: 8,  // MAV_AUTOPILOT_INVALID
+			})
+			require.NoError(t, err)
+			defer node2.Close()
+			go func() {
+				for range node2.Events() {
+				}
+			}()
+
+			node2.SetHeartbeatState(128, 5, 3)
+			require.Error(t, node2.SetHeartbeatComponent(HeartbeatComponent{ComponentId: 1}))
+			require.NoError(t, node2.SetHeartbeatComponent(HeartbeatComponent{
+				ComponentId:  100, // MAV_COMP_ID_CAMERA
+				Type:         30,  // MAV_TYPE_CAMERA
+				Autopilot:    8,
+				SystemStatus: 4,
+			}))
+
+			received := make(map[byte]*MessageHeartbeat)
+			for evt := range node1.Events() {
+				if e, ok := evt.(*EventFrame); ok {
+					received[e.ComponentId()] = e.Message().(*MessageHeartbeat)
+					if len(received) == 2 && received[1].BaseMode == 128 {
+						break
+					}
+				}
+			}
+
+			require.Equal(t, MAV_TYPE(18), received[1].Type)
+			require.Equal(t, MAV_MODE_FLAG(128), received[1].BaseMode)
+			require.Equal(t, uint32(5), received[1].CustomMode)
+			require.Equal(t, MAV_STATE(3), received[1].SystemStatus)
+			require.Equal(t, MAV_TYPE(30), received[100].Type)
+			require.Equal(t, MAV_AUTOPILOT(8), received[100].Autopilot)
+			require.Equal(t, MAV_STATE(4), received[100].SystemStatus)
+
+			node2.RemoveHeartbeatComponent(100)
+		})
+	}
+}
+
+func TestNodeComponent(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+	go func() {
+		for range node2.Events() {
+		}
+	}()
+
+	camera, err := node2.Component(100)
+	require.NoError(t, err)
+	require.Equal(t, byte(100), camera.ComponentId())
+
+	// invalid and already registered components are refused
+	_, err = node2.Component(100)
+	require.Error(t, err)
+	_, err = node2.Component(0)
+	require.Error(t, err)
+	_, err = node2.Component(1)
+	require.Error(t, err)
+
+	// closed components can be registered again
+	camera.Close()
+	camera, err = node2.Component(100)
+	require.NoError(t, err)
+
+	node2.WriteMessageAll(&MessageHeartbeat{})
+	camera.WriteMessageAll(&MessageHeartbeat{})
+	node2.WriteMessageAll(&MessageHeartbeat{})
+	camera.WriteMessageRouted(&MessageHeartbeat{})
+	node2.WriteMessageAll(&MessageHeartbeat{})
+
+	sequenceIds := make(map[byte][]byte)
+	count := 0
+	for evt := range node1.Events() {
+		if e, ok := evt.(*EventFrame); ok {
+			require.Equal(t, byte(11), e.SystemId())
+			sequenceIds[e.ComponentId()] = append(sequenceIds[e.ComponentId()], e.GetSeq())
+			count++
+			if count == 5 {
+				break
+			}
+		}
+	}
+
+	require.Equal(t, map[byte][]byte{
+		1:   {0, 1, 2},
+		100: {0, 1},
+	}, sequenceIds)
+}
+
+func TestNodeRegistry(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		HeartbeatTimeout: 300 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                      MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:             V2,
+		OutSystemId:            11,
+		Endpoints:              []EndpointConf{EndpointCustom{p2}},
+		HeartbeatPeriod:        50 * time.Millisecond,
+		HeartbeatSystemType:    2, // MAV_TYPE_QUADROTOR
+		HeartbeatAutopilotType: 3, // MAV_AUTOPILOT_ARDUPILOTMEGA
+	})
+	require.NoError(t, err)
+
+	for evt := range node1.Events() {
+		if ee, ok := evt.(*EventSystemAppeared); ok {
+			require.Equal(t, byte(11), ee.SystemId)
+			require.Equal(t, byte(1), ee.ComponentId)
+			require.Equal(t, uint8(2), ee.Type)
+			require.Equal(t, uint8(3), ee.Autopilot)
+			break
+		}
+	}
+
+	systems := node1.RemoteSystems()
+	require.Equal(t, 1, len(systems))
+	require.Equal(t, byte(11), systems[0].SystemId)
+	require.Equal(t, uint8(2), systems[0].Type)
+	require.Equal(t, uint8(3), systems[0].Autopilot)
+	require.NotNil(t, systems[0].Channel)
+
+	node2.Close()
+
+	for evt := range node1.Events() {
+		if ee, ok := evt.(*EventSystemLost); ok {
+			require.Equal(t, byte(11), ee.SystemId)
+			require.Equal(t, byte(1), ee.ComponentId)
+			break
+		}
+	}
+
+	require.Equal(t, 0, len(node1.RemoteSystems()))
+}
+
+func TestNodeTimesync(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageTimesync{}}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, msgs),
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+
+			// the vehicle clock starts at boot
+			boot := time.Now().Add(-1 * time.Hour)
+			responses := make(chan *MessageTimesync, 10)
+			go func() {
+				for evt := range vehicle.Events() {
+					if e, ok := evt.(*EventFrame); ok {
+						msg := e.Message().(*MessageTimesync)
+						if msg.Tc1 == 0 {
+							vehicle.WriteMessageTo(e.Channel, &MessageTimesync{
+								Tc1: int64(time.Since(boot)),
+								Ts1: msg.Ts1,
+							})
+						} else {
+							responses <- msg
+						}
+					}
+				}
+			}()
+
+			gcs, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+				TimesyncEnable:   true,
+				TimesyncPeriod:   20 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			go func() {
+				for range gcs.Events() {
+				}
+			}()
+
+			// requests of other systems are answered
+			vehicle.WriteMessageAll(&MessageTimesync{Ts1: 1234})
+			res := <-responses
+			require.Equal(t, int64(1234), res.Ts1)
+			require.NotEqual(t, int64(0), res.Tc1)
+
+			var est TimesyncEstimate
+			for {
+				var ok bool
+				est, ok = gcs.Timesync(1, 1)
+				if ok && est.Samples >= 5 {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			require.InDelta(t, float64(-boot.UnixNano()), float64(est.Offset), float64(50*time.Millisecond))
+			require.True(t, est.RTT < 50*time.Millisecond)
+
+			local, ok := gcs.RemoteTimeBootMs(1, 1, 1000)
+			require.Equal(t, true, ok)
+			require.InDelta(t, float64(boot.Add(1*time.Second).UnixNano()), float64(local.UnixNano()), float64(50*time.Millisecond))
+
+			_, ok = gcs.RemoteTimeUsec(2, 1, 1000)
+			require.Equal(t, false, ok)
+			local, ok = gcs.RemoteTimeUsec(2, 1, 1600000000000000)
+			require.Equal(t, true, ok)
+			require.Equal(t, time.Unix(1600000000, 0), local)
+		})
+	}
+}
+
 func TestNodeStreamRequest(t *testing.T) {
 	success := false
 
@@ -624,3 +1263,728 @@ func TestNodeStreamRequestDynamicMessage(t *testing.T) {
 
 	require.Equal(t, true, success)
 }
+
+func TestNodeStreamRequestMessageInterval(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageCommandLong{}, &MessageCommandAck{}}
+
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, msgs)},
+		{"dynamic", testDialectRT(t, msgs...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                      MustDialectCT(3, msgs),
+				OutVersion:             V2,
+				OutSystemId:            1,
+				Endpoints:              []EndpointConf{EndpointCustom{p1}},
+				HeartbeatPeriod:        50 * time.Millisecond,
+				HeartbeatSystemType:    2,  // MAV_TYPE_QUADROTOR
+				HeartbeatAutopilotType: 12, // MAV_AUTOPILOT_PX4
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+
+			intervals := make(map[float32]float32)
+			done := make(chan struct{})
+			go func() {
+				dropped := false
+				for evt := range vehicle.Events() {
+					if e, ok := evt.(*EventFrame); ok {
+						if msg, ok := e.Message().(*MessageCommandLong); ok &&
+							msg.Command == MAV_CMD_SET_MESSAGE_INTERVAL {
+							// the first command is lost
+							if !dropped {
+								dropped = true
+								continue
+							}
+							result := MAV_RESULT_ACCEPTED
+							if msg.Param1 == 33 {
+								result = MAV_RESULT_DENIED
+							} else {
+								intervals[msg.Param1] = msg.Param2
+							}
+							vehicle.WriteMessageTo(e.Channel, &MessageCommandAck{
+								Command: msg.Command,
+								Result:  result,
+							})
+							if len(intervals) == 2 && msg.Param1 != 33 {
+								close(done)
+							}
+						}
+					}
+				}
+			}()
+
+			gcs, err := NewNode(NodeConf{
+				D:                   ca.d,
+				OutVersion:          V2,
+				OutSystemId:         255,
+				Endpoints:           []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable:    true,
+				StreamRequestEnable: true,
+				StreamRequestMode:   StreamRequestMessageInterval,
+				StreamRequestMessages: map[uint32]float64{
+					24: 0,
+					30: 10,
+					33: 5,
+				},
+				CommandTimeout: 50 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+
+			for evt := range gcs.Events() {
+				if e, ok := evt.(*EventStreamRequested); ok {
+					require.Equal(t, byte(1), e.SystemId)
+					require.Equal(t, byte(1), e.ComponentId)
+					require.Equal(t, []uint32{33}, e.Rejected)
+					break
+				}
+			}
+
+			<-done
+			require.Equal(t, map[float32]float32{
+				24: -1,
+				30: 100000,
+			}, intervals)
+		})
+	}
+}
+
+func TestNodeStreamRequestMessageIntervalMultipleChannels(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageCommandLong{}, &MessageCommandAck{}}
+	p1, p2 := net.Pipe()
+	p3, p4 := net.Pipe()
+
+	vehicle, err := NewNode(NodeConf{
+		D:                      MustDialectCT(3, msgs),
+		OutVersion:             V2,
+		OutSystemId:            1,
+		Endpoints:              []EndpointConf{EndpointCustom{p1}, EndpointCustom{p3}},
+		HeartbeatPeriod:        50 * time.Millisecond,
+		HeartbeatSystemType:    2,  // MAV_TYPE_QUADROTOR
+		HeartbeatAutopilotType: 12, // MAV_AUTOPILOT_PX4
+	})
+	require.NoError(t, err)
+	defer vehicle.Close()
+
+	go func() {
+		for evt := range vehicle.Events() {
+			if e, ok := evt.(*EventFrame); ok {
+				if msg, ok := e.Message().(*MessageCommandLong); ok {
+					// acks are sent through the channel of the command
+					vehicle.WriteMessageTo(e.Channel, &MessageCommandAck{
+						Command: msg.Command,
+						Result:  MAV_RESULT_ACCEPTED,
+					})
+				}
+			}
+		}
+	}()
+
+	gcs, err := NewNode(NodeConf{
+		D:                     MustDialectCT(3, msgs),
+		OutVersion:            V2,
+		OutSystemId:           255,
+		Endpoints:             []EndpointConf{EndpointCustom{p2}, EndpointCustom{p4}},
+		HeartbeatDisable:      true,
+		StreamRequestEnable:   true,
+		StreamRequestMode:     StreamRequestMessageInterval,
+		StreamRequestMessages: map[uint32]float64{30: 10},
+		CommandTimeout:        200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer gcs.Close()
+
+	// the target is requested independently through each channel
+	channels := make(map[*Channel]struct{})
+	for evt := range gcs.Events() {
+		if e, ok := evt.(*EventStreamRequested); ok {
+			require.Equal(t, []uint32(nil), e.Rejected)
+			channels[e.Channel] = struct{}{}
+			if len(channels) == 2 {
+				break
+			}
+		}
+	}
+}
+
+func TestNodeStreamRequestMessageIntervalClose(t *testing.T) {
+	p1, _ := net.Pipe()
+
+	node, err := NewNode(NodeConf{
+		D:                     MustDialectCT(3, []Message{&MessageHeartbeat{}, &MessageCommandLong{}, &MessageCommandAck{}}),
+		OutVersion:            V2,
+		OutSystemId:           255,
+		Endpoints:             []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable:      true,
+		StreamRequestEnable:   true,
+		StreamRequestMode:     StreamRequestMessageInterval,
+		StreamRequestMessages: map[uint32]float64{30: 10},
+	})
+	require.NoError(t, err)
+	sr := node.nodeStreamRequest
+	node.Close()
+
+	// channels are closed after modules, therefore heartbeats can be received
+	// after the module has been closed. They must not start requests.
+	sr.onEventFrame(&EventFrame{&FrameV2{
+		SystemId:    1,
+		ComponentId: 1,
+		Message: &MessageHeartbeat{
+			Type:      MAV_TYPE_QUADROTOR,
+			Autopilot: MAV_AUTOPILOT_PX4,
+		},
+	}, nil})
+	require.Equal(t, 0, len(sr.pending))
+}
+
+func TestNodeStreamRequestMessageIntervalNonAutopilot(t *testing.T) {
+	msgs := []Message{&MessageHeartbeat{}, &MessageCommandLong{}, &MessageCommandAck{}}
+
+	for _, ca := range []struct {
+		name      string
+		typ       MAV_TYPE
+		autopilot MAV_AUTOPILOT
+	}{
+		{"gcs", MAV_TYPE_GCS, MAV_AUTOPILOT_PX4},
+		{"companion", MAV_TYPE_ONBOARD_CONTROLLER, MAV_AUTOPILOT_PX4},
+		{"generic", MAV_TYPE_QUADROTOR, MAV_AUTOPILOT_GENERIC},
+		{"invalid", MAV_TYPE_QUADROTOR, MAV_AUTOPILOT_INVALID},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			other, err := NewNode(NodeConf{
+				D:                      MustDialectCT(3, msgs),
+				OutVersion:             V2,
+				OutSystemId:            1,
+				Endpoints:              []EndpointConf{EndpointCustom{p1}},
+				HeartbeatPeriod:        10 * time.Millisecond,
+				HeartbeatSystemType:    int(ca.typ),
+				HeartbeatAutopilotType: int(ca.autopilot),
+			})
+			require.NoError(t, err)
+			defer other.Close()
+
+			requested := make(chan struct{}, 1)
+			go func() {
+				for evt := range other.Events() {
+					if e, ok := evt.(*EventFrame); ok {
+						if _, ok := e.Message().(*MessageCommandLong); ok {
+							select {
+							case requested <- struct{}{}:
+							default:
+							}
+						}
+					}
+				}
+			}()
+
+			gcs, err := NewNode(NodeConf{
+				D:                     MustDialectCT(3, msgs),
+				OutVersion:            V2,
+				OutSystemId:           255,
+				Endpoints:             []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable:      true,
+				StreamRequestEnable:   true,
+				StreamRequestMode:     StreamRequestMessageInterval,
+				StreamRequestMessages: map[uint32]float64{30: 10},
+				CommandTimeout:        50 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+
+			heartbeats := 0
+			for evt := range gcs.Events() {
+				if _, ok := evt.(*EventStreamRequested); ok {
+					t.Fatal("unexpected stream request")
+				}
+				if e, ok := evt.(*EventFrame); ok {
+					if _, ok := e.Message().(*MessageHeartbeat); ok {
+						heartbeats++
+						if heartbeats == 5 {
+							break
+						}
+					}
+				}
+			}
+
+			select {
+			case <-requested:
+				t.Fatal("unexpected command")
+			default:
+			}
+		})
+	}
+}
+
+func TestNodeAddRemoveEndpoint(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}}
+	p1, p2 := net.Pipe()
+	p3, p4 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p4}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+	go func() {
+		for range node2.Events() {
+		}
+	}()
+
+	evt := <-node1.Events()
+	require.Equal(t, EndpointCustom{p1}, evt.(*EventChannelOpen).Channel.Endpoint.Conf())
+
+	e, err := node1.AddEndpoint(EndpointCustom{p3})
+	require.NoError(t, err)
+	require.Equal(t, EndpointCustom{p3}, e.Conf())
+
+	evt = <-node1.Events()
+	ch := evt.(*EventChannelOpen).Channel
+	require.Equal(t, e, ch.Endpoint)
+
+	node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 1})
+	evt = <-node1.Events()
+	require.Equal(t, ch, evt.(*EventFrame).Channel)
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, evt.(*EventFrame).Message())
+
+	err = node1.RemoveEndpoint(e)
+	require.NoError(t, err)
+
+	evt = <-node1.Events()
+	require.Equal(t, &EventChannelClose{ch}, evt)
+
+	err = node1.RemoveEndpoint(e)
+	require.Error(t, err)
+
+	// the other endpoint is still working
+	p2.Close()
+	evt = <-node1.Events()
+	require.Equal(t, EndpointCustom{p1}, evt.(*EventChannelClose).Channel.Endpoint.Conf())
+}
+
+func TestNodeRemoveEndpointAccepter(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}}
+	p1, _ := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	<-node1.Events()
+
+	e, err := node1.AddEndpoint(EndpointTcpServer{"127.0.0.1:5601"})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:5601")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	evt := <-node1.Events()
+	ch := evt.(*EventChannelOpen).Channel
+	require.Equal(t, e, ch.Endpoint)
+
+	err = node1.RemoveEndpoint(e)
+	require.NoError(t, err)
+
+	evt = <-node1.Events()
+	require.Equal(t, &EventChannelClose{ch}, evt)
+
+	_, err = net.Dial("tcp", "127.0.0.1:5601")
+	require.Error(t, err)
+}
+
+func TestNodeRemoveEndpointStalled(t *testing.T) {
+	stalled := &testStalledWriter{make(testLoopback), make(chan struct{}, 1), make(chan struct{})}
+	l1 := make(testLoopback, 10)
+
+	node, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, []Message{&MessageHeartbeat{}}),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{
+			EndpointCustom{stalled},
+			EndpointCustom{&testEndpoint{make(testLoopback), l1}},
+		},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node.Close()
+
+	var stalledCh *Channel
+	var healthyCh *Channel
+	for evt := range node.Events() {
+		if e, ok := evt.(*EventChannelOpen); ok {
+			if _, ok := e.Channel.Endpoint.Conf().(EndpointCustom).ReadWriteCloser.(*testStalledWriter); ok {
+				stalledCh = e.Channel
+			} else {
+				healthyCh = e.Channel
+			}
+			if stalledCh != nil && healthyCh != nil {
+				break
+			}
+		}
+	}
+
+	// wait until the stalled channel is stuck in a write
+	node.WriteMessageTo(stalledCh, &MessageHeartbeat{})
+	<-stalled.writing
+
+	removed := make(chan error)
+	go func() {
+		removed <- node.RemoveEndpoint(stalledCh.Endpoint)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the node must keep working while queued frames are written
+	node.WriteMessageTo(healthyCh, &MessageHeartbeat{})
+	select {
+	case <-l1:
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame not received")
+	}
+
+	close(stalled.release)
+	select {
+	case err := <-removed:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("endpoint not removed")
+	}
+	require.Equal(t, &EventChannelClose{stalledCh}, <-node.Events())
+}
+
+func TestNodeEndpointOverride(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}}
+	key := NewKey(bytes.Repeat([]byte("\x4F"), 32))
+
+	_, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		OutKey:      key,
+		Endpoints: []EndpointConf{EndpointOverride{
+			Endpoint:   EndpointCustom{&testEndpoint{make(testLoopback), make(testLoopback)}},
+			OutVersion: V1,
+		}},
+		HeartbeatDisable: true,
+	})
+	require.Error(t, err)
+
+	p1, p2 := net.Pipe()
+	p3, p4 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{
+			EndpointOverride{
+				Endpoint:   EndpointCustom{p1},
+				InVersion:  V1,
+				OutVersion: V1,
+			},
+			EndpointOverride{
+				Endpoint: EndpointCustom{p3},
+				D:        MustDialectCT(3, msgs),
+				InKey:    key,
+				OutKey:   key,
+			},
+		},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	legacy, err := NewParser(ParserConf{
+		Reader:      p2,
+		Writer:      p2,
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 11,
+	})
+	require.NoError(t, err)
+
+	signed, err := NewParser(ParserConf{
+		Reader:      p4,
+		Writer:      p4,
+		D:           MustDialectCT(3, msgs),
+		InKey:       key,
+		OutVersion:  V2,
+		OutSystemId: 12,
+		OutKey:      key,
+	})
+	require.NoError(t, err)
+
+	<-node1.Events()
+	<-node1.Events()
+
+	go node1.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: 1})
+
+	frame, err := legacy.Read()
+	require.NoError(t, err)
+	require.IsType(t, &FrameV1{}, frame)
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 1}, frame.GetMessage())
+
+	frame, err = signed.Read()
+	require.NoError(t, err)
+	require.IsType(t, &FrameV2{}, frame)
+	require.Equal(t, true, frame.(*FrameV2).IsSigned())
+
+	// V2 frames are discarded by the V1 channel
+	go legacy.WriteMessage(&MessageSystemTime{TimeUnixUsec: 2})
+	evt := <-node1.Events()
+	require.IsType(t, &EventParseError{}, evt)
+
+	go signed.WriteMessage(&MessageSystemTime{TimeUnixUsec: 3})
+	evt = <-node1.Events()
+	require.Equal(t, &MessageSystemTime{TimeUnixUsec: 3}, evt.(*EventFrame).Message())
+}
+
+func TestNodeEndpointOverrideDialect(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}}
+	dnode := testDialectRT(t, &MessageSystemTime{}, &MessageAttitude{})
+
+	p1, p2 := net.Pipe()
+	p3, p4 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:           dnode,
+		OutVersion:  V2,
+		OutSystemId: 10,
+		Endpoints: []EndpointConf{
+			EndpointOverride{
+				Endpoint: EndpointCustom{p1},
+				D:        testDialectRT(t, msgs...),
+			},
+			EndpointOverride{
+				Endpoint: EndpointCustom{p3},
+				D:        MustDialectCT(3, msgs),
+			},
+		},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	var channels []*Channel
+	for len(channels) < 2 {
+		evt := <-node1.Events()
+		if e, ok := evt.(*EventChannelOpen); ok {
+			channels = append(channels, e.Channel)
+		}
+	}
+	go func() {
+		for range node1.Events() {
+		}
+	}()
+
+	var parsers []*Parser
+	for _, rw := range []net.Conn{p2, p4} {
+		p, err := NewParser(ParserConf{
+			Reader:      rw,
+			Writer:      rw,
+			D:           MustDialectCT(3, msgs),
+			OutVersion:  V2,
+			OutSystemId: 11,
+		})
+		require.NoError(t, err)
+		parsers = append(parsers, p)
+	}
+
+	// messages of the node dialect are converted into the dialect of each channel,
+	// while messages that are not in the dialect of the channel are discarded
+	att := dialectNewMessage(dnode, 30)
+	msg := dialectNewMessage(dnode, 2).(*DynamicMessage)
+	msg.Fields["time_unix_usec"] = uint64(5)
+	go func() {
+		node1.WriteMessageAll(att)
+		node1.WriteMessageAll(msg)
+	}()
+
+	for _, p := range parsers {
+		frame, err := p.Read()
+		require.NoError(t, err)
+		require.Equal(t, &MessageSystemTime{TimeUnixUsec: 5}, frame.GetMessage())
+	}
+
+	// stats are updated after frames are written
+	for _, ch := range channels {
+		var stats *ChannelStats
+		for i := 0; i < 100; i++ {
+			stats = ch.Stats()
+			if stats.FramesOut == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, uint64(1), stats.FramesOut)
+		require.Equal(t, uint64(1), stats.WriteErrors)
+	}
+}
+
+func TestNodeWritePriority(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}, &MessageCommandLong{}, &MessageAttitude{}}
+	p1, p2 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		WritePriorities: map[uint32]Priority{
+			2: PriorityLow,
+		},
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	ch := (<-node1.Events()).(*EventChannelOpen).Channel
+	go func() {
+		for range node1.Events() {
+		}
+	}()
+
+	// frames are not read, therefore they are queued
+	node1.WriteMessageTo(ch, &MessageCommandLong{Command: MAV_CMD_COMPONENT_ARM_DISARM})
+	node1.WriteMessageTo(ch, &MessageSystemTime{TimeUnixUsec: 1})
+	node1.WriteMessageTo(ch, &MessageAttitude{Roll: 1})
+	node1.WriteMessageTo(ch, &MessageAttitude{Roll: 2})
+	node1.WriteMessageToPriority(ch, &MessageAttitude{Roll: 3}, PriorityHigh)
+	node1.WriteMessageRoutedPriority(&MessageAttitude{Roll: 5}, PriorityHigh)
+	component, err := node1.Component(2)
+	require.NoError(t, err)
+	component.WriteMessageAllPriority(&MessageSystemTime{TimeUnixUsec: 2}, PriorityHigh)
+	err = node1.TryWriteMessageTo(ch, &MessageAttitude{Roll: 4})
+	require.NoError(t, err)
+
+	parser, err := NewParser(ParserConf{
+		Reader:      p2,
+		Writer:      p2,
+		D:           MustDialectCT(3, msgs),
+		OutVersion:  V2,
+		OutSystemId: 11,
+	})
+	require.NoError(t, err)
+
+	var received []Message
+	for i := 0; i < 8; i++ {
+		frame, err := parser.Read()
+		require.NoError(t, err)
+		received = append(received, frame.GetMessage())
+	}
+
+	require.Equal(t, []Message{
+		&MessageCommandLong{Command: MAV_CMD_COMPONENT_ARM_DISARM},
+		&MessageAttitude{Roll: 3},
+		&MessageAttitude{Roll: 5},
+		&MessageSystemTime{TimeUnixUsec: 2},
+		&MessageAttitude{Roll: 1},
+		&MessageAttitude{Roll: 2},
+		&MessageAttitude{Roll: 4},
+		&MessageSystemTime{TimeUnixUsec: 1},
+	}, received)
+}
+
+func TestNodeDedup(t *testing.T) {
+	msgs := []Message{&MessageSystemTime{}}
+	p1, p2 := net.Pipe()
+	p3, p4 := net.Pipe()
+
+	node1, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      10,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}, EndpointCustom{p3}},
+		HeartbeatDisable: true,
+		DedupEnable:      true,
+	})
+	require.NoError(t, err)
+	defer node1.Close()
+
+	// the remote node is connected through two redundant links
+	node2, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, msgs),
+		OutVersion:       V2,
+		OutSystemId:      11,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}, EndpointCustom{p4}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node2.Close()
+
+	var channels1 []*Channel
+	for i := 0; i < 2; i++ {
+		channels1 = append(channels1, (<-node1.Events()).(*EventChannelOpen).Channel)
+	}
+
+	var channels2 []*Channel
+	for i := 0; i < 2; i++ {
+		channels2 = append(channels2, (<-node2.Events()).(*EventChannelOpen).Channel)
+	}
+	go func() {
+		for range node2.Events() {
+		}
+	}()
+
+	for i := 1; i <= 3; i++ {
+		node2.WriteMessageAll(&MessageSystemTime{TimeUnixUsec: uint64(i)})
+	}
+
+	// sentinels are different on each link
+	node2.WriteMessageTo(channels2[0], &MessageSystemTime{TimeBootMs: 1})
+	node2.WriteMessageTo(channels2[1], &MessageSystemTime{TimeBootMs: 2})
+
+	var times []uint64
+	sentinels := 0
+	for sentinels < 2 {
+		evt := <-node1.Events()
+		if fr, ok := evt.(*EventFrame); ok {
+			msg := fr.Message().(*MessageSystemTime)
+			if msg.TimeBootMs != 0 {
+				sentinels++
+			} else {
+				times = append(times, msg.TimeUnixUsec)
+			}
+		}
+	}
+	require.Equal(t, []uint64{1, 2, 3}, times)
+	go func() {
+		for range node1.Events() {
+		}
+	}()
+
+	suppressed := uint64(0)
+	for _, ch := range channels1 {
+		suppressed += ch.Stats().DuplicatesSuppressed
+	}
+	require.Equal(t, uint64(3), suppressed)
+}
@@ -0,0 +1,198 @@
+package gomavlib
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// weight of a new sample in the filtered offset and RTT
+	_TIMESYNC_FILTER_ALPHA = 0.2
+	// samples with a RTT greater than this factor multiplied by the filtered RTT
+	// are discarded
+	_TIMESYNC_MAX_RTT_FACTOR = 3
+	// samples with a RTT lower than this are never discarded
+	_TIMESYNC_MIN_RTT = 10 * time.Millisecond
+	// the filter is reset after this number of consecutive discarded samples
+	_TIMESYNC_MAX_DISCARDED = 5
+	// number of sent requests whose responses are accepted
+	_TIMESYNC_PENDING_REQUESTS = 8
+	// remote timestamps greater than this (September 2001) are already in
+	// Unix time
+	_TIMESYNC_UNIX_THRESHOLD_USEC = 1000000000000000
+)
+
+// TimesyncEstimate is the estimated relation between the clock of a remote
+// system and the local clock.
+type TimesyncEstimate struct {
+	// the offset of the remote clock with respect to the local wall clock.
+	// Remote time = local time + offset.
+	Offset time.Duration
+	// the filtered round trip time
+	RTT time.Duration
+	// the number of samples used to compute the estimate
+	Samples int
+}
+
+type timesyncKey struct {
+	SystemId    byte
+	ComponentId byte
+}
+
+type timesyncState struct {
+	estimate  TimesyncEstimate
+	discarded int
+}
+
+type nodeTimesync struct {
+	n         *Node
+	terminate chan struct{}
+
+	mutex   sync.Mutex
+	pending []int64
+	states  map[timesyncKey]*timesyncState
+}
+
+func newNodeTimesync(n *Node) *nodeTimesync {
+	// module is disabled
+	if n.conf.TimesyncEnable == false {
+		return nil
+	}
+
+	// timesync message must exist in dialect and correspond to standard
+	if dialectHasMessage(n.conf.D, 111, 34) == false {
+		return nil
+	}
+
+	return &nodeTimesync{
+		n:         n,
+		terminate: make(chan struct{}, 1),
+		states:    make(map[timesyncKey]*timesyncState),
+	}
+}
+
+func (ts *nodeTimesync) close() {
+	ts.terminate <- struct{}{}
+}
+
+func (ts *nodeTimesync) run() {
+	ticker := time.NewTicker(ts.n.conf.TimesyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ts1 := now.UnixNano()
+
+			func() {
+				ts.mutex.Lock()
+				defer ts.mutex.Unlock()
+
+				ts.pending = append(ts.pending, ts1)
+				if len(ts.pending) > _TIMESYNC_PENDING_REQUESTS {
+					ts.pending = ts.pending[1:]
+				}
+			}()
+
+			msg := dialectNewMessage(ts.n.conf.D, 111)
+			messageSetFields(msg, map[string]interface{}{
+				"tc1": int64(0),
+				"ts1": ts1,
+			})
+			ts.n.WriteMessageAll(msg)
+
+		case <-ts.terminate:
+			return
+		}
+	}
+}
+
+func (ts *nodeTimesync) onEventFrame(evt *EventFrame) {
+	if evt.Message().GetId() != 111 {
+		return
+	}
+
+	// newer versions of the message contain the target
+	if target, ok := messageFieldUint(evt.Message(), "target_system"); ok &&
+		target != 0 && byte(target) != ts.n.conf.OutSystemId {
+		return
+	}
+
+	tc1, _ := messageFieldUint(evt.Message(), "tc1")
+	ts1, _ := messageFieldUint(evt.Message(), "ts1")
+	now := time.Now().UnixNano()
+
+	// request
+	if tc1 == 0 {
+		msg := dialectNewMessage(ts.n.conf.D, 111)
+		messageSetFields(msg, map[string]interface{}{
+			"tc1": now,
+			"ts1": int64(ts1),
+		})
+		if _, ok := messageField(msg, "target_system"); ok {
+			messageSetFields(msg, map[string]interface{}{
+				"target_system":    evt.SystemId(),
+				"target_component": evt.ComponentId(),
+			})
+		}
+		ts.n.WriteMessageTo(evt.Channel, msg)
+		return
+	}
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	// response to a request sent by another node
+	found := false
+	for _, p := range ts.pending {
+		if p == int64(ts1) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	rtt := time.Duration(now - int64(ts1))
+	offset := time.Duration(int64(tc1) - (int64(ts1)+now)/2)
+
+	key := timesyncKey{evt.SystemId(), evt.ComponentId()}
+	state, ok := ts.states[key]
+	if !ok {
+		state = &timesyncState{}
+		ts.states[key] = state
+	}
+
+	// discard samples delayed by congestion, unless the link got slower
+	if state.estimate.Samples > 0 &&
+		rtt > _TIMESYNC_MIN_RTT &&
+		rtt > state.estimate.RTT*_TIMESYNC_MAX_RTT_FACTOR {
+		state.discarded++
+		if state.discarded < _TIMESYNC_MAX_DISCARDED {
+			return
+		}
+		state.estimate = TimesyncEstimate{}
+	}
+	state.discarded = 0
+
+	if state.estimate.Samples == 0 {
+		state.estimate.Offset = offset
+		state.estimate.RTT = rtt
+	} else {
+		state.estimate.Offset += time.Duration(_TIMESYNC_FILTER_ALPHA * float64(offset-state.estimate.Offset))
+		state.estimate.RTT += time.Duration(_TIMESYNC_FILTER_ALPHA * float64(rtt-state.estimate.RTT))
+	}
+	state.estimate.Samples++
+}
+
+func (ts *nodeTimesync) estimate(systemId byte, componentId byte) (TimesyncEstimate, bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	state, ok := ts.states[timesyncKey{systemId, componentId}]
+	if !ok || state.estimate.Samples == 0 {
+		return TimesyncEstimate{}, false
+	}
+	return state.estimate, true
+}
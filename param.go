@@ -0,0 +1,192 @@
+package gomavlib
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// maximum length of a parameter name
+	_PARAM_NAME_LENGTH = 16
+)
+
+// ParamType is the type of a parameter (MAV_PARAM_TYPE).
+type ParamType uint8
+
+const (
+	ParamTypeUint8  ParamType = 1
+	ParamTypeInt8   ParamType = 2
+	ParamTypeUint16 ParamType = 3
+	ParamTypeInt16  ParamType = 4
+	ParamTypeUint32 ParamType = 5
+	ParamTypeInt32  ParamType = 6
+	ParamTypeUint64 ParamType = 7
+	ParamTypeInt64  ParamType = 8
+	ParamTypeReal32 ParamType = 9
+	ParamTypeReal64 ParamType = 10
+)
+
+// String implements fmt.Stringer.
+func (t ParamType) String() string {
+	switch t {
+	case ParamTypeUint8:
+		return "uint8"
+	case ParamTypeInt8:
+		return "int8"
+	case ParamTypeUint16:
+		return "uint16"
+	case ParamTypeInt16:
+		return "int16"
+	case ParamTypeUint32:
+		return "uint32"
+	case ParamTypeInt32:
+		return "int32"
+	case ParamTypeUint64:
+		return "uint64"
+	case ParamTypeInt64:
+		return "int64"
+	case ParamTypeReal32:
+		return "real32"
+	case ParamTypeReal64:
+		return "real64"
+	}
+	return fmt.Sprintf("ParamType(%d)", uint8(t))
+}
+
+// ParamEncoding is the way integer parameters are encoded into the float
+// field of PARAM_VALUE and PARAM_SET.
+type ParamEncoding int
+
+const (
+	// ParamEncodingBytewise copies the bytes of the integer into the float
+	// (MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_BYTEWISE). It is used by PX4.
+	ParamEncodingBytewise ParamEncoding = iota
+	// ParamEncodingCast converts the integer into a float
+	// (MAV_PROTOCOL_CAPABILITY_PARAM_ENCODE_C_CAST). It is used by Ardupilot.
+	ParamEncodingCast
+)
+
+// Param is a parameter of a system.
+type Param struct {
+	// the parameter name
+	Name string
+	// the parameter type
+	Type ParamType
+	// the parameter value, decoded according to its type
+	Value float64
+	// the parameter index
+	Index uint16
+}
+
+// paramCheck checks whether a value can be represented by a parameter type.
+func paramCheck(typ ParamType, value float64) error {
+	var min, max float64
+
+	switch typ {
+	case ParamTypeUint8:
+		min, max = 0, math.MaxUint8
+	case ParamTypeInt8:
+		min, max = math.MinInt8, math.MaxInt8
+	case ParamTypeUint16:
+		min, max = 0, math.MaxUint16
+	case ParamTypeInt16:
+		min, max = math.MinInt16, math.MaxInt16
+	case ParamTypeUint32:
+		min, max = 0, math.MaxUint32
+	case ParamTypeInt32:
+		min, max = math.MinInt32, math.MaxInt32
+	case ParamTypeReal32:
+		return nil
+	default:
+		// 64 bit parameters cannot be transmitted with PARAM_VALUE
+		return fmt.Errorf("unsupported parameter type: %s", typ)
+	}
+
+	if value < min || value > max || value != math.Trunc(value) {
+		return fmt.Errorf("value %v is not a valid %s", value, typ)
+	}
+	return nil
+}
+
+// paramEncode encodes a parameter value into the float field of PARAM_VALUE
+// and PARAM_SET.
+func paramEncode(enc ParamEncoding, typ ParamType, value float64) float32 {
+	if typ == ParamTypeReal32 || enc == ParamEncodingCast {
+		return float32(value)
+	}
+
+	var bits uint32
+	switch typ {
+	case ParamTypeUint8:
+		bits = uint32(uint8(value))
+	case ParamTypeInt8:
+		bits = uint32(uint8(int8(value)))
+	case ParamTypeUint16:
+		bits = uint32(uint16(value))
+	case ParamTypeInt16:
+		bits = uint32(uint16(int16(value)))
+	case ParamTypeUint32:
+		bits = uint32(value)
+	case ParamTypeInt32:
+		bits = uint32(int32(value))
+	}
+	return math.Float32frombits(bits)
+}
+
+// paramDecode decodes a parameter value from the float field of PARAM_VALUE
+// and PARAM_SET.
+func paramDecode(enc ParamEncoding, typ ParamType, value float32) float64 {
+	if typ == ParamTypeReal32 || enc == ParamEncodingCast {
+		return float64(value)
+	}
+
+	bits := math.Float32bits(value)
+	switch typ {
+	case ParamTypeUint8:
+		return float64(uint8(bits))
+	case ParamTypeInt8:
+		return float64(int8(bits))
+	case ParamTypeUint16:
+		return float64(uint16(bits))
+	case ParamTypeInt16:
+		return float64(int16(bits))
+	case ParamTypeUint32:
+		return float64(bits)
+	case ParamTypeInt32:
+		return float64(int32(bits))
+	}
+	return float64(value)
+}
+
+func dialectHasParamProtocol(d Dialect) bool {
+	return dialectHasMessage(d, 20, 214) && // PARAM_REQUEST_READ
+		dialectHasMessage(d, 21, 159) && // PARAM_REQUEST_LIST
+		dialectHasMessage(d, 22, 220) && // PARAM_VALUE
+		dialectHasMessage(d, 23, 168) // PARAM_SET
+}
+
+// paramFromMessage decodes a PARAM_VALUE or a PARAM_SET.
+func paramFromMessage(enc ParamEncoding, msg Message) *Param {
+	name, _ := messageField(msg, "param_id")
+	typ, _ := messageFieldUint(msg, "param_type")
+	index, _ := messageFieldUint(msg, "param_index")
+
+	// the value is read without converting it into a float64, that would
+	// alter the NaNs produced by the bytewise encoding
+	var value float32
+	raw, _ := messageField(msg, "param_value")
+	switch tv := raw.(type) {
+	case float32:
+		value = tv
+	case JsonFloat32:
+		value = tv.F
+	}
+
+	p := &Param{
+		Type:  ParamType(typ),
+		Value: paramDecode(enc, ParamType(typ), value),
+		Index: uint16(index),
+	}
+	p.Name, _ = name.(string)
+	return p
+}
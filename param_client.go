@@ -0,0 +1,429 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ParamClientConf allows to configure a ParamClient.
+type ParamClientConf struct {
+	// the node used to communicate with the target.
+	Node *Node
+
+	// the system id of the target.
+	SystemId byte
+
+	// (optional) the component id of the target.
+	// It defaults to 1 (MAV_COMP_ID_AUTOPILOT1).
+	ComponentId byte
+
+	// (optional) the encoding of integer parameters used by the target.
+	// It defaults to ParamEncodingBytewise.
+	Encoding ParamEncoding
+
+	// (optional) the time to wait for each response of the target.
+	// It defaults to 1 second.
+	Timeout time.Duration
+
+	// (optional) the number of times a request is sent again when the target
+	// does not respond. It defaults to 3.
+	Retries int
+}
+
+// ParamClient implements the client side of the parameter protocol. It keeps
+// a cache of the parameters of a target, that is filled by Fetch(), Get() and
+// Set() and is kept updated with the PARAM_VALUE messages sent by the target.
+// When the value of a cached parameter changes, an EventParamChange is emitted.
+// Methods must not be called by the routine that reads Events(), since incoming
+// frames are not processed until events are consumed.
+type ParamClient struct {
+	conf    ParamClientConf
+	handler *frameListener
+	opMutex sync.Mutex
+	updated chan struct{}
+
+	mutex    sync.Mutex
+	params   map[string]*Param
+	count    int
+	received map[uint16]struct{}
+}
+
+// NewParamClient allocates a ParamClient. See ParamClientConf for the options.
+func NewParamClient(conf ParamClientConf) (*ParamClient, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if conf.SystemId < 1 {
+		return nil, fmt.Errorf("SystemId must be >= 1")
+	}
+	if conf.ComponentId == 0 {
+		conf.ComponentId = 1
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 1 * time.Second
+	}
+	if conf.Retries == 0 {
+		conf.Retries = 3
+	}
+
+	if dialectHasParamProtocol(conf.Node.conf.D) == false {
+		return nil, fmt.Errorf("the dialect does not support the parameter protocol")
+	}
+
+	c := &ParamClient{
+		conf:    conf,
+		updated: make(chan struct{}, 1),
+		params:  make(map[string]*Param),
+		count:   -1,
+	}
+
+	c.handler = conf.Node.addFrameHandler(c.isParamValue, c.onParamValue)
+
+	return c, nil
+}
+
+// Close stops updating the cache.
+func (c *ParamClient) Close() {
+	c.conf.Node.removeFrameListener(c.handler)
+}
+
+func (c *ParamClient) isParamValue(evt *EventFrame) bool {
+	return evt.SystemId() == c.conf.SystemId &&
+		evt.ComponentId() == c.conf.ComponentId &&
+		evt.Message().GetId() == 22
+}
+
+func (c *ParamClient) onParamValue(evt *EventFrame) {
+	p := paramFromMessage(c.conf.Encoding, evt.Message())
+	if p.Name == "" {
+		return
+	}
+	count, _ := messageFieldUint(evt.Message(), "param_count")
+
+	changed, previous := func() (bool, float64) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		c.count = int(count)
+
+		old, ok := c.params[p.Name]
+
+		// the index of parameters sent in response to PARAM_SET may be unknown
+		if p.Index == 0xFFFF && ok {
+			p.Index = old.Index
+		}
+
+		c.params[p.Name] = p
+
+		if c.received != nil && p.Index != 0xFFFF {
+			c.received[p.Index] = struct{}{}
+		}
+
+		if ok && old.Value != p.Value {
+			return true, old.Value
+		}
+		return false, 0
+	}()
+
+	select {
+	case c.updated <- struct{}{}:
+	default:
+	}
+
+	if changed {
+		pc := *p
+		c.conf.Node.emitEvent(&EventParamChange{
+			Channel:     evt.Channel,
+			SystemId:    evt.SystemId(),
+			ComponentId: evt.ComponentId(),
+			Param:       &pc,
+			Previous:    previous,
+		})
+	}
+}
+
+// Params returns the cached parameters, sorted by index.
+func (c *ParamClient) Params() []*Param {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ret := make([]*Param, 0, len(c.params))
+	for _, p := range c.params {
+		pc := *p
+		ret = append(ret, &pc)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+
+	return ret
+}
+
+// Param returns a cached parameter.
+func (c *ParamClient) Param(name string) (*Param, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p, ok := c.params[name]
+	if ok == false {
+		return nil, false
+	}
+	pc := *p
+	return &pc, true
+}
+
+func (c *ParamClient) newMessage(id uint32, fields map[string]interface{}) (Message, error) {
+	msg := dialectNewMessage(c.conf.Node.conf.D, id)
+	err := messageSetFields(msg, map[string]interface{}{
+		"target_system":    c.conf.SystemId,
+		"target_component": c.conf.ComponentId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = messageSetFields(msg, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// waitUpdates waits until cond is true or no parameter is received for Timeout.
+func (c *ParamClient) waitUpdates(ctx context.Context, cond func() bool) (bool, error) {
+	timer := time.NewTimer(c.conf.Timeout)
+	defer timer.Stop()
+
+	for {
+		if cond() {
+			return true, nil
+		}
+
+		select {
+		case <-c.updated:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.conf.Timeout)
+
+		case <-timer.C:
+			return cond(), nil
+
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// Fetch downloads all parameters of the target into the cache. Parameters
+// that are lost during the transfer are requested again individually.
+func (c *ParamClient) Fetch(ctx context.Context) error {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+
+	func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.count = -1
+		c.received = make(map[uint16]struct{})
+	}()
+
+	defer func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.received = nil
+	}()
+
+	complete := func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.count >= 0 && len(c.received) >= c.count
+	}
+
+	countKnown := func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.count >= 0
+	}
+
+	req, err := c.newMessage(21, nil)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= c.conf.Retries; attempt++ {
+		c.conf.Node.WriteMessageRouted(req)
+
+		_, err := c.waitUpdates(ctx, complete)
+		if err != nil {
+			return err
+		}
+
+		if countKnown() {
+			break
+		}
+	}
+
+	if countKnown() == false {
+		return ErrRequestTimeout
+	}
+
+	missing := func() []uint16 {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		var ret []uint16
+		for i := 0; i < c.count; i++ {
+			if _, ok := c.received[uint16(i)]; !ok {
+				ret = append(ret, uint16(i))
+			}
+		}
+		return ret
+	}()
+
+	for _, index := range missing {
+		req, err := c.newMessage(20, map[string]interface{}{
+			"param_id":    "",
+			"param_index": int16(index),
+		})
+		if err != nil {
+			return err
+		}
+
+		received := func() bool {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			_, ok := c.received[index]
+			return ok
+		}
+
+		ok := false
+		for attempt := 0; attempt <= c.conf.Retries && !ok; attempt++ {
+			c.conf.Node.WriteMessageRouted(req)
+
+			ok, err = c.waitUpdates(ctx, received)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !ok {
+			return ErrRequestTimeout
+		}
+	}
+
+	return nil
+}
+
+func (c *ParamClient) listen(name string) *frameListener {
+	return c.conf.Node.addFrameListener(func(evt *EventFrame) bool {
+		if c.isParamValue(evt) == false {
+			return false
+		}
+		id, _ := messageField(evt.Message(), "param_id")
+		return id == name
+	})
+}
+
+func (c *ParamClient) get(ctx context.Context, name string) (*Param, error) {
+	if len(name) > _PARAM_NAME_LENGTH {
+		return nil, fmt.Errorf("parameter name is too long")
+	}
+
+	l := c.listen(name)
+	defer c.conf.Node.removeFrameListener(l)
+
+	req, err := c.newMessage(20, map[string]interface{}{
+		"param_id":    name,
+		"param_index": int16(-1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	evt, err := c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+		func(evt *EventFrame) (bool, error) {
+			return true, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// the cache is updated before frames are sent to listeners
+	if p, ok := c.Param(name); ok {
+		return p, nil
+	}
+	return paramFromMessage(c.conf.Encoding, evt.Message()), nil
+}
+
+// Get reads a parameter from the target and stores it into the cache.
+func (c *ParamClient) Get(ctx context.Context, name string) (*Param, error) {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+
+	return c.get(ctx, name)
+}
+
+// Set changes the value of a parameter of the target. The function waits for
+// the target to confirm the new value, and sends the request again in case of
+// timeout. If the parameter is not in the cache, it is read first in order to
+// obtain its type.
+func (c *ParamClient) Set(ctx context.Context, name string, value float64) (*Param, error) {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+
+	p, ok := c.Param(name)
+	if !ok {
+		var err error
+		p, err = c.get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := paramCheck(p.Type, value)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := paramEncode(c.conf.Encoding, p.Type, value)
+	expected := paramDecode(c.conf.Encoding, p.Type, encoded)
+
+	l := c.listen(name)
+	defer c.conf.Node.removeFrameListener(l)
+
+	req, err := c.newMessage(23, map[string]interface{}{
+		"param_id":    name,
+		"param_value": encoded,
+		"param_type":  p.Type,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the target may send the previous value before the new one,
+	// therefore only values equal to the requested one are accepted
+	var last *Param
+	evt, err := c.conf.Node.request(ctx, l, req, c.conf.Timeout, c.conf.Retries,
+		func(evt *EventFrame) (bool, error) {
+			last = paramFromMessage(c.conf.Encoding, evt.Message())
+			return last.Value == expected, nil
+		})
+	if err == ErrRequestTimeout && last != nil {
+		return last, fmt.Errorf("parameter %s was not changed by the target (value is %v)",
+			name, last.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := c.Param(name); ok {
+		return p, nil
+	}
+	return paramFromMessage(c.conf.Encoding, evt.Message()), nil
+}
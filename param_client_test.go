@@ -0,0 +1,166 @@
+package gomavlib
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testParamMessages = []Message{
+	&MessageHeartbeat{},
+	&MessageParamRequestRead{},
+	&MessageParamRequestList{},
+	&MessageParamValue{},
+	&MessageParamSet{},
+}
+
+// testParamVehicle answers to the parameter protocol with a static dialect.
+// It omits the second parameter when sending the list, in order to test
+// requests of missing parameters, and refuses to change READ_ONLY.
+func testParamVehicle(node *Node, changed chan struct{}) {
+	params := []*MessageParamValue{
+		{ParamId: "SYSID_THISMAV", ParamValue: math.Float32frombits(1), ParamType: MAV_PARAM_TYPE_UINT8},
+		{ParamId: "OFFSET", ParamValue: math.Float32frombits(0xFFFFFFFF), ParamType: MAV_PARAM_TYPE_INT32},
+		{ParamId: "GAIN", ParamValue: 0.5, ParamType: MAV_PARAM_TYPE_REAL32},
+		{ParamId: "READ_ONLY", ParamValue: 3, ParamType: MAV_PARAM_TYPE_REAL32},
+	}
+	for i, p := range params {
+		p.ParamIndex = uint16(i)
+		p.ParamCount = uint16(len(params))
+	}
+
+	for evt := range node.Events() {
+		e, ok := evt.(*EventFrame)
+		if !ok {
+			continue
+		}
+
+		switch msg := e.Message().(type) {
+		case *MessageParamRequestList:
+			for i, p := range params {
+				if i != 1 {
+					node.WriteMessageTo(e.Channel, p)
+				}
+			}
+
+		case *MessageParamRequestRead:
+			for i, p := range params {
+				if (msg.ParamIndex >= 0 && int(msg.ParamIndex) == i) ||
+					(msg.ParamIndex < 0 && msg.ParamId == p.ParamId) {
+					node.WriteMessageTo(e.Channel, p)
+				}
+			}
+
+		case *MessageParamSet:
+			for _, p := range params {
+				if p.ParamId == msg.ParamId {
+					if p.ParamId != "READ_ONLY" {
+						p.ParamValue = msg.ParamValue
+					}
+					node.WriteMessageTo(e.Channel, p)
+				}
+			}
+
+		case *MessageHeartbeat:
+			// the GCS asks the vehicle to change a parameter by itself
+			params[2].ParamValue = 1.5
+			node.WriteMessageTo(e.Channel, params[2])
+			changed <- struct{}{}
+		}
+	}
+}
+
+func TestParamClient(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, testParamMessages)},
+		{"dynamic", testDialectRT(t, testParamMessages...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			p1, p2 := net.Pipe()
+
+			vehicle, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, testParamMessages),
+				OutVersion:       V2,
+				OutSystemId:      1,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer vehicle.Close()
+			changed := make(chan struct{})
+			go testParamVehicle(vehicle, changed)
+
+			gcs, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			events := make(chan *EventParamChange, 10)
+			go func() {
+				for evt := range gcs.Events() {
+					if e, ok := evt.(*EventParamChange); ok {
+						events <- e
+					}
+				}
+			}()
+
+			client, err := NewParamClient(ParamClientConf{
+				Node:     gcs,
+				SystemId: 1,
+				Timeout:  100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			ctx := context.Background()
+
+			err = client.Fetch(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []*Param{
+				{"SYSID_THISMAV", ParamTypeUint8, 1, 0},
+				{"OFFSET", ParamTypeInt32, -1, 1},
+				{"GAIN", ParamTypeReal32, 0.5, 2},
+				{"READ_ONLY", ParamTypeReal32, 3, 3},
+			}, client.Params())
+
+			p, err := client.Set(ctx, "OFFSET", -20)
+			require.NoError(t, err)
+			require.Equal(t, &Param{"OFFSET", ParamTypeInt32, -20, 1}, p)
+
+			evt := <-events
+			require.Equal(t, &Param{"OFFSET", ParamTypeInt32, -20, 1}, evt.Param)
+			require.Equal(t, float64(-1), evt.Previous)
+
+			_, err = client.Set(ctx, "SYSID_THISMAV", 300)
+			require.Error(t, err)
+
+			_, err = client.Set(ctx, "READ_ONLY", 4)
+			require.Error(t, err)
+
+			p, err = client.Get(ctx, "GAIN")
+			require.NoError(t, err)
+			require.Equal(t, 0.5, p.Value)
+
+			_, err = client.Get(ctx, "MISSING")
+			require.Equal(t, ErrRequestTimeout, err)
+
+			gcs.WriteMessageAll(dialectNewMessage(ca.d, 0))
+			<-changed
+			evt = <-events
+			require.Equal(t, &Param{"GAIN", ParamTypeReal32, 1.5, 2}, evt.Param)
+			p, _ = client.Param("GAIN")
+			require.Equal(t, 1.5, p.Value)
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package gomavlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ParamStore is the interface implemented by the objects that persist the
+// parameters of a ParamServer.
+type ParamStore interface {
+	// Load returns the saved parameter values, indexed by name.
+	Load() (map[string]float64, error)
+	// Save saves the values of all parameters, indexed by name.
+	Save(values map[string]float64) error
+}
+
+// ParamStoreFile is a ParamStore that saves parameters into a JSON file.
+type ParamStoreFile struct {
+	// the path of the file
+	Path string
+}
+
+// Load implements ParamStore. A missing file is treated as an empty one.
+func (s ParamStoreFile) Load() (map[string]float64, error) {
+	byts, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var values map[string]float64
+	err = json.Unmarshal(byts, &values)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Save implements ParamStore. The file is replaced atomically.
+func (s ParamStoreFile) Save(values map[string]float64) error {
+	byts, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(byts)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), s.Path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// ParamServerConf allows to configure a ParamServer.
+type ParamServerConf struct {
+	// the node used to communicate with the clients.
+	Node *Node
+
+	// the parameters served, with their default values.
+	// Indexes are assigned in order.
+	Params []*Param
+
+	// (optional) the encoding of integer parameters.
+	// It defaults to ParamEncodingBytewise.
+	Encoding ParamEncoding
+
+	// (optional) the store used to persist parameters. Values saved in the
+	// store replace the default ones.
+	Store ParamStore
+
+	// (optional) the period between the PARAM_VALUE messages sent in response
+	// to PARAM_REQUEST_LIST. It defaults to 10 milliseconds.
+	ListPeriod time.Duration
+}
+
+// ParamServer implements the server side of the parameter protocol. It serves
+// a table of typed parameters on behalf of the node, and answers to the
+// requests addressed to the node's system and component.
+// When a client changes a parameter, an EventParamSet is emitted.
+// Lists are sent in the background, with one parameter every ListPeriod.
+type ParamServer struct {
+	conf    ParamServerConf
+	handler *frameListener
+
+	mutex  sync.Mutex
+	params []*Param
+	byName map[string]*Param
+	// index of the next parameter to send, indexed by channel
+	lists map[*Channel]int
+
+	// serializes changes, that are saved without holding mutex
+	setMutex sync.Mutex
+
+	listRequested chan struct{}
+	terminate     chan struct{}
+	done          chan struct{}
+}
+
+// NewParamServer allocates a ParamServer. See ParamServerConf for the options.
+func NewParamServer(conf ParamServerConf) (*ParamServer, error) {
+	if conf.Node == nil {
+		return nil, fmt.Errorf("Node not provided")
+	}
+	if len(conf.Params) > 0xFFFF {
+		return nil, fmt.Errorf("too many parameters")
+	}
+	if conf.ListPeriod == 0 {
+		conf.ListPeriod = 10 * time.Millisecond
+	}
+
+	if dialectHasParamProtocol(conf.Node.conf.D) == false {
+		return nil, fmt.Errorf("the dialect does not support the parameter protocol")
+	}
+
+	s := &ParamServer{
+		conf:          conf,
+		byName:        make(map[string]*Param),
+		lists:         make(map[*Channel]int),
+		listRequested: make(chan struct{}, 1),
+		terminate:     make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	for i, p := range conf.Params {
+		if p.Name == "" || len(p.Name) > _PARAM_NAME_LENGTH {
+			return nil, fmt.Errorf("invalid parameter name: '%s'", p.Name)
+		}
+		if _, ok := s.byName[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate parameter: %s", p.Name)
+		}
+		err := paramCheck(p.Type, p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %s", p.Name, err)
+		}
+
+		pc := *p
+		pc.Index = uint16(i)
+		s.params = append(s.params, &pc)
+		s.byName[p.Name] = &pc
+	}
+
+	if conf.Store != nil {
+		values, err := conf.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+
+		// saved values of parameters that do not exist anymore or
+		// whose type has changed are ignored
+		for name, value := range values {
+			if p, ok := s.byName[name]; ok && paramCheck(p.Type, value) == nil {
+				p.Value = value
+			}
+		}
+	}
+
+	s.handler = conf.Node.addFrameHandler(s.isRequest, s.onRequest)
+
+	go s.run()
+
+	return s, nil
+}
+
+// Close stops serving parameters. It must be called before closing the node.
+func (s *ParamServer) Close() {
+	s.conf.Node.removeFrameListener(s.handler)
+	close(s.terminate)
+	<-s.done
+}
+
+func (s *ParamServer) run() {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.listRequested:
+		case <-s.terminate:
+			return
+		}
+
+		ticker := time.NewTicker(s.conf.ListPeriod)
+		for s.sendLists() {
+			select {
+			case <-ticker.C:
+			case <-s.terminate:
+				ticker.Stop()
+				return
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+// sendLists sends the next parameter of each list in progress, and returns
+// whether there are lists still in progress. Parameters that do not fit into
+// the outgoing queue of a channel are sent again later.
+func (s *ParamServer) sendLists() bool {
+	type item struct {
+		ch    *Channel
+		index int
+		msg   Message
+	}
+
+	items := func() []item {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		ret := make([]item, 0, len(s.lists))
+		for ch, index := range s.lists {
+			// parameters that can't be encoded are skipped
+			msg, _ := s.newParamValue(s.params[index])
+			ret = append(ret, item{ch, index, msg})
+		}
+		return ret
+	}()
+
+	for _, it := range items {
+		var err error
+		if it.msg != nil {
+			err = s.conf.Node.TryWriteMessageTo(it.ch, it.msg)
+			if err == ErrWriteQueueFull {
+				continue
+			}
+		}
+
+		func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			// the list has been requested again in the meanwhile
+			if index, ok := s.lists[it.ch]; !ok || index != it.index {
+				return
+			}
+
+			// the channel or the node has been closed
+			if err != nil || it.index+1 >= len(s.params) {
+				delete(s.lists, it.ch)
+				return
+			}
+			s.lists[it.ch] = it.index + 1
+		}()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.lists) > 0
+}
+
+func (s *ParamServer) isRequest(evt *EventFrame) bool {
+	switch evt.Message().GetId() {
+	case 20, 21, 23:
+	default:
+		return false
+	}
+
+	ts, _ := messageFieldUint(evt.Message(), "target_system")
+	tc, _ := messageFieldUint(evt.Message(), "target_component")
+	return byte(ts) == s.conf.Node.conf.OutSystemId &&
+		(tc == 0 || byte(tc) == s.conf.Node.conf.OutComponentId)
+}
+
+func (s *ParamServer) newParamValue(p *Param) (Message, error) {
+	msg := dialectNewMessage(s.conf.Node.conf.D, 22)
+	err := messageSetFields(msg, map[string]interface{}{
+		"param_id":    p.Name,
+		"param_value": paramEncode(s.conf.Encoding, p.Type, p.Value),
+		"param_type":  p.Type,
+		"param_count": uint16(len(s.params)),
+		"param_index": p.Index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// values returns the values of all parameters. It must be called with the mutex held.
+func (s *ParamServer) values() map[string]float64 {
+	ret := make(map[string]float64, len(s.params))
+	for _, p := range s.params {
+		ret[p.Name] = p.Value
+	}
+	return ret
+}
+
+// set changes the value of a parameter and saves it. It returns a copy of the
+// parameter and its previous value. The store is called without holding the
+// mutex, in order not to block other requests while it is busy.
+func (s *ParamServer) set(name string, value float64) (*Param, float64, error) {
+	s.setMutex.Lock()
+	defer s.setMutex.Unlock()
+
+	previous, values, err := func() (float64, map[string]float64, error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		p, ok := s.byName[name]
+		if !ok {
+			return 0, nil, fmt.Errorf("parameter not found: %s", name)
+		}
+
+		err := paramCheck(p.Type, value)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		values := s.values()
+		values[name] = value
+		return p.Value, values, nil
+	}()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if s.conf.Store != nil {
+		err := s.conf.Store.Save(values)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.byName[name]
+	p.Value = value
+	pc := *p
+	return &pc, previous, nil
+}
+
+func (s *ParamServer) onRequest(evt *EventFrame) {
+	msg := evt.Message()
+
+	switch msg.GetId() {
+	case 21: // PARAM_REQUEST_LIST
+		// a new request restarts the list
+		func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			if len(s.params) > 0 {
+				s.lists[evt.Channel] = 0
+			}
+		}()
+
+		select {
+		case s.listRequested <- struct{}{}:
+		default:
+		}
+
+	case 20: // PARAM_REQUEST_READ
+		index, _ := messageFieldUint(msg, "param_index")
+		name, _ := messageField(msg, "param_id")
+
+		res := func() Message {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			var p *Param
+			if int16(index) >= 0 {
+				if int(index) < len(s.params) {
+					p = s.params[index]
+				}
+			} else if n, ok := name.(string); ok {
+				p = s.byName[n]
+			}
+
+			// requests of unknown parameters are ignored
+			if p == nil {
+				return nil
+			}
+			msg, _ := s.newParamValue(p)
+			return msg
+		}()
+
+		if res != nil {
+			s.conf.Node.WriteMessageTo(evt.Channel, res)
+		}
+
+	case 23: // PARAM_SET
+		req := paramFromMessage(s.conf.Encoding, msg)
+
+		p, ok := s.Param(req.Name)
+		if !ok {
+			return
+		}
+
+		// when the request is not valid, the current value is sent back
+		var changed *Param
+		var previous float64
+		if req.Type == p.Type {
+			changed, previous, _ = s.set(req.Name, req.Value)
+		}
+
+		if changed == nil {
+			if res, err := s.newParamValue(p); err == nil {
+				s.conf.Node.WriteMessageTo(evt.Channel, res)
+			}
+			return
+		}
+
+		// changes are broadcasted in order to notify all clients
+		if res, err := s.newParamValue(changed); err == nil {
+			s.conf.Node.WriteMessageAll(res)
+		}
+
+		if changed.Value != previous {
+			s.conf.Node.emitEvent(&EventParamSet{
+				Channel:     evt.Channel,
+				SystemId:    evt.SystemId(),
+				ComponentId: evt.ComponentId(),
+				Param:       changed,
+				Previous:    previous,
+			})
+		}
+	}
+}
+
+// Params returns the served parameters, sorted by index.
+func (s *ParamServer) Params() []*Param {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret := make([]*Param, len(s.params))
+	for i, p := range s.params {
+		pc := *p
+		ret[i] = &pc
+	}
+	return ret
+}
+
+// Param returns a served parameter.
+func (s *ParamServer) Param(name string) (*Param, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, ok := s.byName[name]
+	if ok == false {
+		return nil, false
+	}
+	pc := *p
+	return &pc, true
+}
+
+// Set changes the value of a parameter and notifies all clients.
+func (s *ParamServer) Set(name string, value float64) error {
+	p, _, err := s.set(name, value)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.newParamValue(p)
+	if err != nil {
+		return err
+	}
+
+	s.conf.Node.WriteMessageAll(res)
+	return nil
+}
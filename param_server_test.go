@@ -0,0 +1,284 @@
+package gomavlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParamServer(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		d    Dialect
+	}{
+		{"static", MustDialectCT(3, testParamMessages)},
+		{"dynamic", testDialectRT(t, testParamMessages...)},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gomavlib")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			store := ParamStoreFile{filepath.Join(dir, "params.json")}
+			require.NoError(t, store.Save(map[string]float64{
+				"RATE":    20,
+				"MISSING": 1,
+				"MODE":    -1, // invalid for the type, ignored
+			}))
+
+			p1, p2 := net.Pipe()
+
+			companion, err := NewNode(NodeConf{
+				D:                ca.d,
+				OutVersion:       V2,
+				OutSystemId:      1,
+				OutComponentId:   191,
+				Endpoints:        []EndpointConf{EndpointCustom{p1}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer companion.Close()
+			sets := make(chan *EventParamSet, 10)
+			go func() {
+				for evt := range companion.Events() {
+					if e, ok := evt.(*EventParamSet); ok {
+						sets <- e
+					}
+				}
+			}()
+
+			server, err := NewParamServer(ParamServerConf{
+				Node: companion,
+				Params: []*Param{
+					{Name: "RATE", Type: ParamTypeUint16, Value: 10},
+					{Name: "MODE", Type: ParamTypeUint8, Value: 2},
+					{Name: "GAIN", Type: ParamTypeReal32, Value: 0.25},
+					{Name: "OFFSET", Type: ParamTypeInt32, Value: -5},
+				},
+				Store: store,
+			})
+			require.NoError(t, err)
+			defer server.Close()
+
+			gcs, err := NewNode(NodeConf{
+				D:                MustDialectCT(3, testParamMessages),
+				OutVersion:       V2,
+				OutSystemId:      255,
+				Endpoints:        []EndpointConf{EndpointCustom{p2}},
+				HeartbeatDisable: true,
+			})
+			require.NoError(t, err)
+			defer gcs.Close()
+			changes := make(chan *EventParamChange, 10)
+			go func() {
+				for evt := range gcs.Events() {
+					if e, ok := evt.(*EventParamChange); ok {
+						changes <- e
+					}
+				}
+			}()
+
+			client, err := NewParamClient(ParamClientConf{
+				Node:        gcs,
+				SystemId:    1,
+				ComponentId: 191,
+				Timeout:     100 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+
+			ctx := context.Background()
+
+			require.NoError(t, client.Fetch(ctx))
+			require.Equal(t, []*Param{
+				{"RATE", ParamTypeUint16, 20, 0},
+				{"MODE", ParamTypeUint8, 2, 1},
+				{"GAIN", ParamTypeReal32, 0.25, 2},
+				{"OFFSET", ParamTypeInt32, -5, 3},
+			}, client.Params())
+
+			p, err := client.Set(ctx, "OFFSET", -1000)
+			require.NoError(t, err)
+			require.Equal(t, &Param{"OFFSET", ParamTypeInt32, -1000, 3}, p)
+
+			set := <-sets
+			require.Equal(t, byte(255), set.SystemId)
+			require.Equal(t, &Param{"OFFSET", ParamTypeInt32, -1000, 3}, set.Param)
+			require.Equal(t, float64(-5), set.Previous)
+			<-changes
+
+			// requests with a wrong type are refused
+			gcs.WriteMessageAll(&MessageParamSet{
+				TargetSystem:    1,
+				TargetComponent: 191,
+				ParamId:         "MODE",
+				ParamValue:      3,
+				ParamType:       MAV_PARAM_TYPE_REAL32,
+			})
+			p, err = client.Get(ctx, "MODE")
+			require.NoError(t, err)
+			require.Equal(t, float64(2), p.Value)
+
+			require.NoError(t, server.Set("GAIN", 0.75))
+			change := <-changes
+			require.Equal(t, &Param{"GAIN", ParamTypeReal32, 0.75, 2}, change.Param)
+
+			require.Error(t, server.Set("RATE", -1))
+			require.Error(t, server.Set("MISSING", 1))
+
+			values, err := store.Load()
+			require.NoError(t, err)
+			require.Equal(t, map[string]float64{
+				"RATE":   20,
+				"MODE":   2,
+				"GAIN":   0.75,
+				"OFFSET": -1000,
+			}, values)
+		})
+	}
+}
+
+func TestParamServerListLargerThanQueue(t *testing.T) {
+	p1, p2 := net.Pipe()
+
+	companion, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, testParamMessages),
+		OutVersion:       V2,
+		OutSystemId:      1,
+		OutComponentId:   191,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+		WriteQueueSize:   4,
+		WriteQueuePolicy: WriteQueueDropNewest,
+	})
+	require.NoError(t, err)
+	defer companion.Close()
+	companionCh := make(chan *Channel, 1)
+	go func() {
+		for evt := range companion.Events() {
+			if e, ok := evt.(*EventChannelOpen); ok {
+				companionCh <- e.Channel
+			}
+		}
+	}()
+
+	var params []*Param
+	for i := 0; i < 100; i++ {
+		params = append(params, &Param{
+			Name:  fmt.Sprintf("PARAM%d", i),
+			Type:  ParamTypeInt32,
+			Value: float64(i),
+		})
+	}
+
+	server, err := NewParamServer(ParamServerConf{
+		Node:       companion,
+		Params:     params,
+		ListPeriod: time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer server.Close()
+
+	gcs, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, testParamMessages),
+		OutVersion:       V2,
+		OutSystemId:      255,
+		Endpoints:        []EndpointConf{EndpointCustom{p2}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer gcs.Close()
+
+	gcs.WriteMessageAll(&MessageParamRequestList{
+		TargetSystem:    1,
+		TargetComponent: 191,
+	})
+
+	// all parameters are received, in order
+	index := 0
+	for index < len(params) {
+		evt, ok := (<-gcs.Events()).(*EventFrame)
+		if !ok {
+			continue
+		}
+		msg, ok := evt.Message().(*MessageParamValue)
+		if !ok {
+			continue
+		}
+		require.Equal(t, uint16(index), msg.ParamIndex)
+		require.Equal(t, uint16(len(params)), msg.ParamCount)
+		index++
+	}
+
+	require.Equal(t, uint64(0), (<-companionCh).DroppedFrames())
+}
+
+type testParamStoreBlocking struct {
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s *testParamStoreBlocking) Load() (map[string]float64, error) {
+	return nil, nil
+}
+
+func (s *testParamStoreBlocking) Save(values map[string]float64) error {
+	s.saving <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestParamServerSlowStore(t *testing.T) {
+	p1, p2 := net.Pipe()
+	go io.Copy(ioutil.Discard, p2)
+
+	node, err := NewNode(NodeConf{
+		D:                MustDialectCT(3, testParamMessages),
+		OutVersion:       V2,
+		OutSystemId:      1,
+		Endpoints:        []EndpointConf{EndpointCustom{p1}},
+		HeartbeatDisable: true,
+	})
+	require.NoError(t, err)
+	defer node.Close()
+
+	store := &testParamStoreBlocking{
+		saving:  make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	server, err := NewParamServer(ParamServerConf{
+		Node: node,
+		Params: []*Param{
+			{Name: "RATE", Type: ParamTypeUint16, Value: 10},
+		},
+		Store: store,
+	})
+	require.NoError(t, err)
+	defer server.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- server.Set("RATE", 20)
+	}()
+	<-store.saving
+
+	// the server is not blocked while the store is saving, and the value
+	// is changed only after it has been saved
+	p, ok := server.Param("RATE")
+	require.Equal(t, true, ok)
+	require.Equal(t, float64(10), p.Value)
+
+	close(store.release)
+	require.NoError(t, <-done)
+	p, _ = server.Param("RATE")
+	require.Equal(t, float64(20), p.Value)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +21,11 @@ const (
 	V2 Version = iota + 1
 	// V1 wraps outgoing messages in v1 frames.
 	V1
+	// VAuto wraps outgoing messages in v1 frames until a valid v2 frame is
+	// received, then in v2 frames, as recommended by the Mavlink specification.
+	// A v2 frame is valid when its message is in the dialect or its signature
+	// matches InKey.
+	VAuto
 )
 
 // ParserError is the error returned in case of non-fatal parsing errors.
@@ -48,12 +54,16 @@ type ParserConf struct {
 	// If not provided, messages are decoded in the MessageRaw struct.
 	D Dialect
 
+	// (optional) the accepted frame version. Frames with a different version
+	// are discarded. If not provided, both versions are accepted.
+	InVersion Version
 	// (optional) the secret key used to validate incoming frames.
 	// Non-signed frames are discarded. This feature requires v2 frames.
 	InKey *Key
 
 	// Mavlink version used to encode messages. See Version
-	// for the available options.
+	// for the available options. In VAuto mode, outgoing frames are signed
+	// only after switching to v2 frames.
 	OutVersion Version
 	// the system id, added to every outgoing frame and used to identify this
 	// node in the network.
@@ -75,6 +85,14 @@ type Parser struct {
 	writeBuffer          []byte
 	curWriteSequenceId   byte
 	curReadSignatureTime uint64
+
+	// sequence ids of the other components of the system
+	componentSequenceIds map[byte]byte
+
+	// in VAuto mode, it is set to 1 when a valid v2 frame is received.
+	// it is accessed atomically since frames are read and written by
+	// different routines.
+	autoV2 int32
 }
 
 // NewParser allocates a Parser, a low level frame encoder and decoder.
@@ -96,14 +114,19 @@ func NewParser(conf ParserConf) (*Parser, error) {
 	if conf.OutComponentId < 1 {
 		conf.OutComponentId = 1
 	}
-	if conf.OutKey != nil && conf.OutVersion != V2 {
+	if conf.OutKey != nil && conf.OutVersion == V1 {
 		return nil, fmt.Errorf("OutKey requires V2 frames")
 	}
+	if conf.InKey != nil && conf.InVersion == V1 {
+		return nil, fmt.Errorf("InKey requires V2 frames")
+	}
 
 	p := &Parser{
 		conf:        conf,
 		readBuffer:  bufio.NewReaderSize(conf.Reader, _NET_BUFFER_SIZE),
 		writeBuffer: make([]byte, 0, _NET_BUFFER_SIZE),
+
+		componentSequenceIds: make(map[byte]byte),
 	}
 	return p, nil
 }
@@ -279,6 +302,14 @@ func (p *Parser) Read() (Frame, error) {
 		return nil, newParserError("unrecognized magic byte: %x", magicByte)
 	}
 
+	if (p.conf.InVersion == V1 && f.GetVersion() != 1) ||
+		(p.conf.InVersion == V2 && f.GetVersion() != 2) {
+		return nil, newParserError("frame version not accepted (%d)", f.GetVersion())
+	}
+
+	// whether the frame has been validated by its signature or checksum
+	verified := false
+
 	if p.conf.InKey != nil {
 		ff, ok := f.(*FrameV2)
 		if ok == false {
@@ -299,6 +330,7 @@ func (p *Parser) Read() (Frame, error) {
 		if ff.SignatureTimestamp > p.curReadSignatureTime {
 			p.curReadSignatureTime = ff.SignatureTimestamp
 		}
+		verified = true
 	}
 
 	// decode message if in dialect and validate checksum
@@ -308,6 +340,7 @@ func (p *Parser) Read() (Frame, error) {
 				return nil, newParserError("wrong checksum (expected %.4x, got %.4x, id=%d)",
 					sum, f.GetChecksum(), f.GetMessage().GetId())
 			}
+			verified = true
 
 			_, isFrameV2 := f.(*FrameV2)
 			msg, err := (*mp).decode(f.GetMessage().(*MessageRaw).Content, isFrameV2)
@@ -324,22 +357,48 @@ func (p *Parser) Read() (Frame, error) {
 		}
 	}
 
+	// switch to v2 once the other side has proved to support it. Frames that
+	// can't be validated are not taken into account, since they may be noise
+	// that happens to contain the v2 magic byte.
+	if p.conf.OutVersion == VAuto && f.GetVersion() == 2 && verified {
+		atomic.StoreInt32(&p.autoV2, 1)
+	}
+
 	return f, nil
 }
 
+// OutVersion returns the version currently used to encode messages.
+// It differs from the configured one only in VAuto mode, in which it is
+// V1 until a valid v2 frame is received, and V2 afterwards.
+func (p *Parser) OutVersion() Version {
+	if p.conf.OutVersion == VAuto {
+		if atomic.LoadInt32(&p.autoV2) == 1 {
+			return V2
+		}
+		return V1
+	}
+	return p.conf.OutVersion
+}
+
 // WriteMessage writes a Message into the writer.
 // It must not be called by multiple routines in parallel.
 func (p *Parser) WriteMessage(message Message) error {
+	return p.writeMessageAs(p.conf.OutComponentId, message)
+}
+
+// writeMessageAs writes a Message on behalf of another component of the system.
+// Each component has its own sequence id.
+func (p *Parser) writeMessageAs(componentId byte, message Message) error {
 	var f Frame
-	if p.conf.OutVersion == V1 {
+	if p.OutVersion() == V1 {
 		f = &FrameV1{Message: message}
 	} else {
 		f = &FrameV2{Message: message}
 	}
-	return p.writeFrameAndFill(f)
+	return p.writeFrameAndFill(f, componentId)
 }
 
-func (p *Parser) writeFrameAndFill(frame Frame) error {
+func (p *Parser) writeFrameAndFill(frame Frame, componentId byte) error {
 	if frame.GetMessage() == nil {
 		return fmt.Errorf("message is nil")
 	}
@@ -349,17 +408,25 @@ func (p *Parser) writeFrameAndFill(frame Frame) error {
 	safeFrame := frame.Clone()
 
 	// fill SequenceId, SystemId, ComponentId
+	sequenceId := p.curWriteSequenceId
+	if componentId != p.conf.OutComponentId {
+		sequenceId = p.componentSequenceIds[componentId]
+	}
 	switch ff := safeFrame.(type) {
 	case *FrameV1:
-		ff.SequenceId = p.curWriteSequenceId
+		ff.SequenceId = sequenceId
 		ff.SystemId = p.conf.OutSystemId
-		ff.ComponentId = p.conf.OutComponentId
+		ff.ComponentId = componentId
 	case *FrameV2:
-		ff.SequenceId = p.curWriteSequenceId
+		ff.SequenceId = sequenceId
 		ff.SystemId = p.conf.OutSystemId
-		ff.ComponentId = p.conf.OutComponentId
+		ff.ComponentId = componentId
+	}
+	if componentId != p.conf.OutComponentId {
+		p.componentSequenceIds[componentId]++
+	} else {
+		p.curWriteSequenceId++
 	}
-	p.curWriteSequenceId++
 
 	// fill CompatibilityFlag, IncompatibilityFlag if v2
 	if ff, ok := safeFrame.(*FrameV2); ok {
@@ -316,3 +316,77 @@ func TestParserWriteFrameIsConst(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, frame, original)
 }
+
+func TestParserVersionAuto(t *testing.T) {
+	d := MustDialectCT(3, []Message{&MessageHeartbeat{}})
+	in := bytes.NewBuffer(nil)
+	out := bytes.NewBuffer(nil)
+
+	parser, err := NewParser(ParserConf{
+		Reader:      in,
+		Writer:      out,
+		D:           d,
+		OutVersion:  VAuto,
+		OutSystemId: 1,
+		OutKey:      NewKey(bytes.Repeat([]byte("\x7C"), 32)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, V1, parser.OutVersion())
+
+	for _, msg := range []struct {
+		ver Version
+		msg Message
+	}{
+		{V1, &MessageHeartbeat{}},
+		{V2, &MessageSystemTime{}},
+		{V2, &MessageHeartbeat{}},
+	} {
+		remote, err := NewParser(ParserConf{
+			Reader:      bytes.NewBuffer(nil),
+			Writer:      in,
+			D:           MustDialectCT(3, []Message{msg.msg}),
+			OutVersion:  msg.ver,
+			OutSystemId: 2,
+		})
+		require.NoError(t, err)
+		err = remote.WriteMessage(msg.msg)
+		require.NoError(t, err)
+	}
+
+	reader, err := NewParser(ParserConf{
+		Reader:      out,
+		Writer:      bytes.NewBuffer(nil),
+		D:           d,
+		OutVersion:  V2,
+		OutSystemId: 3,
+	})
+	require.NoError(t, err)
+
+	// v1 frames do not change the version
+	_, err = parser.Read()
+	require.NoError(t, err)
+	require.Equal(t, V1, parser.OutVersion())
+
+	err = parser.WriteMessage(&MessageHeartbeat{})
+	require.NoError(t, err)
+	frame, err := reader.Read()
+	require.NoError(t, err)
+	require.IsType(t, &FrameV1{}, frame)
+
+	// v2 frames whose checksum can't be verified do not change the version
+	_, err = parser.Read()
+	require.NoError(t, err)
+	require.Equal(t, V1, parser.OutVersion())
+
+	// the first verified v2 frame switches to v2
+	_, err = parser.Read()
+	require.NoError(t, err)
+	require.Equal(t, V2, parser.OutVersion())
+
+	err = parser.WriteMessage(&MessageHeartbeat{})
+	require.NoError(t, err)
+	frame, err = reader.Read()
+	require.NoError(t, err)
+	require.IsType(t, &FrameV2{}, frame)
+	require.Equal(t, true, frame.(*FrameV2).IsSigned())
+}